@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"log"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/bases"
+	"github.com/btwiuse/buildahfy/corpus"
+	"github.com/btwiuse/buildahfy/graph"
+	"github.com/btwiuse/pretty"
+)
+
+// basesMain inventories the base images of the corpus and optionally
+// draws which locally built images are built from which.
+func basesMain(args []string) {
+	format, lineage, images, jobs := "", "", "", 0
+	buildArgs := kvFlag{}
+	fs := flag.NewFlagSet("bases", flag.ExitOnError)
+	fs.StringVar(&format, "format", "text", "output format: text, json, or refs for the bases of each record as ndjson")
+	fs.StringVar(&lineage, "lineage", "", "write the lineage of locally built images to `file` as DOT")
+	fs.StringVar(&images, "images", "", "read the image each record builds from `file`, one \"<id> <image>\" per line; by default a Dockerfile in a directory builds an image named after it")
+	fs.Var(buildArgs, "build-arg", "build-time variable `key=value`")
+	fs.IntVar(&jobs, "j", runtime.NumCPU(), "number of records to process in parallel")
+	storePath := addStoreFlag(fs)
+	in := addInputFlags(fs)
+	fs.Parse(args)
+	checkFormat(format, "text", "json", "refs")
+	names, err := readImages(images)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	st := openStore(*storePath)
+	defer st.Close()
+	report := bases.NewReport()
+	extract := func(rec *corpus.Record) interface{} {
+		var refs []bases.Ref
+		loadStored(st, bucket("bases", buildArgsOption(buildArgs)...), rec, &refs, func() error {
+			var err error
+			if refs, err = bases.Extract(strings.NewReader(rec.Contents), buildArgs); err != nil {
+				refs = nil
+			}
+			return nil
+		})
+		return refs
+	}
+	emit := func(rec *corpus.Record, res interface{}) error {
+		refs := res.([]bases.Ref)
+		image, ok := names[rec.Id]
+		if !ok && images == "" {
+			image = imageOf(rec.Id)
+		}
+		report.Add(bases.Image(image), refs)
+		if format == "refs" && refs != nil {
+			pretty.Json(struct {
+				Id    string
+				Image string `json:",omitempty"`
+				Bases []bases.Ref
+			}{rec.Id, image, refs})
+		}
+		return nil
+	}
+	if err := in.mapRecords(nil, jobs, extract, emit); err != nil {
+		mapFailed(err)
+	}
+
+	switch format {
+	case "text":
+		err = report.WriteText(os.Stdout)
+	case "json":
+		err = report.WriteJSON(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if lineage == "" {
+		return
+	}
+	f, err := os.Create(lineage)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	graph.Lineage(f, report.Lineage())
+}
+
+// imageOf names the image a record builds after the directory holding
+// it, for Ids that are paths such as "images/base/Dockerfile" or, from
+// git history, "<commit>:images/base/Dockerfile".
+func imageOf(id string) string {
+	if i := strings.Index(id, ":"); i >= 0 && !strings.Contains(id[:i], "/") {
+		id = id[i+1:]
+	}
+	dir := path.Dir(id)
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	return strings.ToLower(path.Base(dir))
+}
+
+func readImages(file string) (map[string]string, error) {
+	names := map[string]string{}
+	if file == "" {
+		return names, nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 {
+			names[fields[0]] = fields[1]
+		}
+	}
+	return names, scanner.Err()
+}
@@ -0,0 +1,57 @@
+package bases
+
+import (
+	"regexp"
+
+	"github.com/btwiuse/buildahfy/step"
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/moby/buildkit/frontend/dockerfile/shell"
+)
+
+var variable = regexp.MustCompile(`\$\{?([a-zA-Z_][a-zA-Z0-9_]*)`)
+
+// Args are the ARGs declared before the first FROM of a Dockerfile,
+// which its FROMs may use.
+type Args struct {
+	lex    *shell.Lex
+	values map[string]string
+	known  map[string]bool
+}
+
+// NewArgs collects the ARGs of meta, the steps before the first FROM,
+// the way dockerfile2llb does, with buildArgs overriding their defaults.
+func NewArgs(meta []step.Step, escape rune, buildArgs map[string]string) *Args {
+	a := &Args{lex: shell.NewLex(escape), values: map[string]string{}, known: map[string]bool{}}
+	for _, s := range meta {
+		arg, ok := s.Instruction.(*instructions.ArgCommand)
+		if !ok {
+			continue
+		}
+		if v, ok := buildArgs[arg.Key]; ok {
+			a.values[arg.Key], a.known[arg.Key] = v, true
+			continue
+		}
+		if arg.Value == nil {
+			a.values[arg.Key] = ""
+			continue
+		}
+		v, _ := a.lex.ProcessWordWithMap(*arg.Value, a.values)
+		a.values[arg.Key], a.known[arg.Key] = v, true
+	}
+	return a
+}
+
+// Expand substitutes the ARGs in base.
+func (a *Args) Expand(base string) (string, error) {
+	return a.lex.ProcessWordWithMap(base, a.values)
+}
+
+// Known reports whether every ARG base uses has a value.
+func (a *Args) Known(base string) bool {
+	for _, m := range variable.FindAllStringSubmatch(base, -1) {
+		if !a.known[m[1]] {
+			return false
+		}
+	}
+	return true
+}
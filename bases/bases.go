@@ -0,0 +1,116 @@
+// Package bases inventories the base images Dockerfiles build from.
+package bases
+
+import (
+	"io"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/step"
+	"github.com/docker/distribution/reference"
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// Ref is the base of one stage.
+type Ref struct {
+	Line int `json:"line"`
+	// Raw is the base as written and Resolved the base with build args
+	// substituted.
+	Raw      string `json:"raw"`
+	Resolved string `json:"resolved"`
+	// Unresolved is set if the base uses an ARG without a value.
+	Unresolved bool `json:"unresolved,omitempty"`
+	Scratch    bool `json:"scratch,omitempty"`
+	// Stage is set if the base is an earlier stage of the same file.
+	Stage bool `json:"stage,omitempty"`
+	// Name is the normalized repository, such as
+	// docker.io/library/alpine; it is empty for scratch, stages and
+	// bases that are not valid references.
+	Name       string `json:"name,omitempty"`
+	Registry   string `json:"registry,omitempty"`
+	Repository string `json:"repository,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+	Invalid    string `json:"invalid,omitempty"`
+}
+
+// Latest reports whether the base resolves to the latest tag, either
+// explicitly or by having neither tag nor digest.
+func (r *Ref) Latest() bool {
+	return r.Name != "" && r.Digest == "" && (r.Tag == "" || r.Tag == "latest")
+}
+
+// Extract returns the base of every stage of a Dockerfile, resolving the
+// ARGs declared before the first FROM the way dockerfile2llb does, with
+// buildArgs overriding their defaults.
+func Extract(r io.Reader, buildArgs map[string]string) ([]Ref, error) {
+	res, err := parser.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := step.FromAST(res.AST)
+	if err != nil {
+		return nil, err
+	}
+	return FromSteps(steps, res.EscapeToken, buildArgs), nil
+}
+
+// FromSteps returns the base of every stage of a Dockerfile already
+// parsed into steps with the escape token escape, as Extract does.
+func FromSteps(steps []step.Step, escape rune, buildArgs map[string]string) []Ref {
+	meta, stages := step.Stages(steps)
+	args := NewArgs(meta, escape, buildArgs)
+
+	refs := []Ref{}
+	names := map[string]bool{}
+	for _, st := range stages {
+		stage := st[0].Instruction.(*instructions.Stage)
+		ref := Ref{Line: st[0].Node.StartLine, Raw: stage.BaseName}
+		var err error
+		ref.Resolved, err = args.Expand(stage.BaseName)
+		if err != nil {
+			ref.Resolved = stage.BaseName
+		}
+		ref.Unresolved = !args.Known(stage.BaseName)
+		switch {
+		case names[strings.ToLower(ref.Resolved)]:
+			ref.Stage = true
+		case ref.Resolved == "scratch":
+			ref.Scratch = true
+		default:
+			ref.normalize()
+		}
+		if stage.Name != "" {
+			names[stage.Name] = true
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+func (r *Ref) normalize() {
+	named, err := reference.ParseNormalizedNamed(r.Resolved)
+	if err != nil {
+		r.Invalid = err.Error()
+		return
+	}
+	r.Name = named.Name()
+	r.Registry = reference.Domain(named)
+	r.Repository = reference.Path(named)
+	if tagged, ok := named.(reference.Tagged); ok {
+		r.Tag = tagged.Tag()
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		r.Digest = digested.Digest().String()
+	}
+}
+
+// Image returns the normalized repository of an image name, or "" if it
+// is not a valid reference.
+func Image(name string) string {
+	named, err := reference.ParseNormalizedNamed(name)
+	if err != nil {
+		return ""
+	}
+	return named.Name()
+}
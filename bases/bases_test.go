@@ -0,0 +1,53 @@
+package bases
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	dockerfile := "ARG TAG=3.8\nARG REG\nFROM python:${TAG} AS build\nFROM ${REG}/app\nFROM build\nFROM scratch\n"
+	for _, tc := range []struct {
+		name      string
+		buildArgs map[string]string
+		want      []Ref
+	}{
+		{"defaults", nil, []Ref{
+			{Resolved: "python:3.8", Name: "docker.io/library/python", Tag: "3.8"},
+			{Resolved: "/app", Unresolved: true},
+			{Resolved: "build", Stage: true},
+			{Resolved: "scratch", Scratch: true},
+		}},
+		{"build args", map[string]string{"TAG": "3.12", "REG": "ghcr.io/x"}, []Ref{
+			{Resolved: "python:3.12", Name: "docker.io/library/python", Tag: "3.12"},
+			{Resolved: "ghcr.io/x/app", Name: "ghcr.io/x/app"},
+			{Resolved: "build", Stage: true},
+			{Resolved: "scratch", Scratch: true},
+		}},
+	} {
+		refs, err := Extract(strings.NewReader(dockerfile), tc.buildArgs)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if len(refs) != len(tc.want) {
+			t.Fatalf("%s: got %d refs, want %d", tc.name, len(refs), len(tc.want))
+		}
+		for i, want := range tc.want {
+			got := refs[i]
+			if got.Resolved != want.Resolved || got.Unresolved != want.Unresolved || got.Stage != want.Stage ||
+				got.Scratch != want.Scratch || got.Name != want.Name || got.Tag != want.Tag {
+				t.Errorf("%s: ref %d is %+v, want %+v", tc.name, i, got, want)
+			}
+		}
+	}
+}
+
+func TestExtractEscape(t *testing.T) {
+	refs, err := Extract(strings.NewReader("# escape=`\nARG V=1\nFROM alpine:`$V\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refs[0].Resolved != "alpine:$V" {
+		t.Errorf("resolved %q, want the escaped $ kept", refs[0].Resolved)
+	}
+}
@@ -0,0 +1,200 @@
+package bases
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Repository counts the uses of one base repository.
+type Repository struct {
+	Registry   string         `json:"registry"`
+	Repository string         `json:"repository"`
+	Refs       int            `json:"refs"`
+	Files      int            `json:"files"`
+	Tags       map[string]int `json:"tags"`
+	Digests    int            `json:"digests"`
+	Latest     int            `json:"latest"`
+}
+
+// Report aggregates the bases of a corpus.
+type Report struct {
+	Files  int `json:"files"`
+	Failed int `json:"failed"`
+	Refs   int `json:"refs"`
+
+	Stages     int `json:"stages"`
+	Scratch    int `json:"scratch"`
+	Unresolved int `json:"unresolved"`
+	Invalid    int `json:"invalid"`
+	Pinned     int `json:"pinned"`
+	Latest     int `json:"latest"`
+	// Untagged counts the bases that are latest for lack of a tag.
+	Untagged int `json:"untagged"`
+
+	Registries   map[string]int         `json:"registries"`
+	Repositories map[string]*Repository `json:"repositories"`
+
+	// lineage maps each locally built image to its bases.
+	lineage map[string]map[string]bool
+}
+
+func NewReport() *Report {
+	return &Report{
+		Registries:   map[string]int{},
+		Repositories: map[string]*Repository{},
+		lineage:      map[string]map[string]bool{},
+	}
+}
+
+// Add counts the bases of one file. image is the normalized repository
+// the file builds, or "" if it is not known; nil refs count as a file
+// that failed to parse.
+func (rep *Report) Add(image string, refs []Ref) {
+	rep.Files++
+	if refs == nil {
+		rep.Failed++
+		return
+	}
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		rep.Refs++
+		if ref.Unresolved {
+			rep.Unresolved++
+		}
+		switch {
+		case ref.Stage:
+			rep.Stages++
+			continue
+		case ref.Scratch:
+			rep.Scratch++
+			continue
+		case ref.Invalid != "":
+			rep.Invalid++
+			continue
+		}
+		if ref.Digest != "" {
+			rep.Pinned++
+		}
+		if ref.Latest() {
+			rep.Latest++
+			if ref.Tag == "" {
+				rep.Untagged++
+			}
+		}
+		rep.Registries[ref.Registry]++
+		repo, ok := rep.Repositories[ref.Name]
+		if !ok {
+			repo = &Repository{Registry: ref.Registry, Repository: ref.Repository, Tags: map[string]int{}}
+			rep.Repositories[ref.Name] = repo
+		}
+		repo.Refs++
+		if !seen[ref.Name] {
+			repo.Files++
+			seen[ref.Name] = true
+		}
+		if ref.Tag != "" {
+			repo.Tags[ref.Tag]++
+		}
+		if ref.Digest != "" {
+			repo.Digests++
+		}
+		if ref.Latest() {
+			repo.Latest++
+		}
+		if image != "" {
+			if rep.lineage[image] == nil {
+				rep.lineage[image] = map[string]bool{}
+			}
+			rep.lineage[image][ref.Name] = true
+		}
+	}
+}
+
+func (rep *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rep)
+}
+
+func (rep *Report) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "%d files, %d failed to parse, %d FROM instructions\n\n", rep.Files, rep.Failed, rep.Refs)
+	for _, c := range []struct {
+		name  string
+		count int
+	}{
+		{"earlier stage", rep.Stages},
+		{"scratch", rep.Scratch},
+		{"unresolved ARG", rep.Unresolved},
+		{"invalid reference", rep.Invalid},
+		{"pinned by digest", rep.Pinned},
+		{"latest", rep.Latest},
+		{"latest, untagged", rep.Untagged},
+	} {
+		fmt.Fprintf(w, "%-24s %8d\n", c.name, c.count)
+	}
+
+	fmt.Fprintf(w, "\n%-40s %8s\n", "registry", "refs")
+	registries := []string{}
+	for r := range rep.Registries {
+		registries = append(registries, r)
+	}
+	sort.Slice(registries, func(i, j int) bool {
+		a, b := registries[i], registries[j]
+		return rep.Registries[a] > rep.Registries[b] || rep.Registries[a] == rep.Registries[b] && a < b
+	})
+	for _, r := range registries {
+		fmt.Fprintf(w, "%-40s %8d\n", r, rep.Registries[r])
+	}
+
+	fmt.Fprintf(w, "\n%-48s %8s %8s %8s %8s  %s\n", "repository", "refs", "files", "latest", "digests", "tags")
+	names := []string{}
+	for name := range rep.Repositories {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := rep.Repositories[names[i]], rep.Repositories[names[j]]
+		return a.Refs > b.Refs || a.Refs == b.Refs && names[i] < names[j]
+	})
+	for _, name := range names {
+		repo := rep.Repositories[name]
+		fmt.Fprintf(w, "%-48s %8d %8d %8d %8d  %s\n", name, repo.Refs, repo.Files, repo.Latest, repo.Digests, topTags(repo.Tags, 5))
+	}
+	return nil
+}
+
+// topTags lists the n most used tags.
+func topTags(tags map[string]int, n int) string {
+	keys := []string{}
+	for t := range tags {
+		keys = append(keys, t)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return tags[keys[i]] > tags[keys[j]] || tags[keys[i]] == tags[keys[j]] && keys[i] < keys[j]
+	})
+	s := ""
+	for i, t := range keys {
+		if i == n {
+			s += " ..."
+			break
+		}
+		if i > 0 {
+			s += " "
+		}
+		s += fmt.Sprintf("%s(%d)", t, tags[t])
+	}
+	return s
+}
+
+// Lineage returns each locally built image and its bases.
+func (rep *Report) Lineage() map[string][]string {
+	out := map[string][]string{}
+	for image, bases := range rep.lineage {
+		for base := range bases {
+			out[image] = append(out[image], base)
+		}
+		sort.Strings(out[image])
+	}
+	return out
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/btwiuse/buildahfy/corpus"
+)
+
+// checkpointFlags make a corpus run resumable.
+type checkpointFlags struct {
+	state  string
+	resume bool
+	output string
+
+	out *os.File
+	cp  *corpus.Checkpoint
+}
+
+func addCheckpointFlags(fs *flag.FlagSet) *checkpointFlags {
+	ck := &checkpointFlags{}
+	fs.StringVar(&ck.state, "state", "", "record the records finished in `file`, for -resume")
+	fs.BoolVar(&ck.resume, "resume", false, "skip the records finished by the run recorded in -state")
+	fs.StringVar(&ck.output, "o", "", "write to `file` instead of stdout; with -resume, output past the last finished record is dropped and the rest appended")
+	return ck
+}
+
+// open opens the output and the state file and returns a function that
+// closes them.
+func (ck *checkpointFlags) open() func() {
+	if ck.resume && ck.state == "" {
+		log.Fatal("-resume needs -state")
+	}
+	var err error
+	if ck.state != "" {
+		if ck.cp, err = corpus.OpenCheckpoint(ck.state, ck.resume); err != nil {
+			log.Fatal(err)
+		}
+	}
+	ck.out = os.Stdout
+	switch {
+	case ck.output == "":
+	case !ck.resume:
+		if ck.out, err = os.Create(ck.output); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		if ck.out, err = os.OpenFile(ck.output, os.O_WRONLY|os.O_CREATE, 0644); err != nil {
+			log.Fatal(err)
+		}
+		// outputs such as /dev/null cannot be cut back, nor need to be
+		if fi, err := ck.out.Stat(); err != nil || !fi.Mode().IsRegular() {
+			break
+		}
+		if err := ck.out.Truncate(ck.cp.Size); err != nil {
+			log.Fatal(err)
+		}
+		if _, err := ck.out.Seek(ck.cp.Size, io.SeekStart); err != nil {
+			log.Fatal(err)
+		}
+	}
+	return func() {
+		if ck.cp != nil {
+			ck.cp.Close()
+		}
+		if ck.out != os.Stdout {
+			ck.out.Close()
+		}
+	}
+}
+
+// source skips the records finished by an earlier run when resuming.
+func (ck *checkpointFlags) source(src corpus.Source) corpus.Source {
+	if ck == nil || ck.cp == nil || !ck.resume {
+		return src
+	}
+	return ck.cp.Source(src)
+}
+
+// quarantine hands input a source sets aside to set, and records it as
+// quarantined so that a resumed run does not set it aside again.
+func (ck *checkpointFlags) quarantine(set func(*corpus.Quarantined) error) func(*corpus.Quarantined) error {
+	if ck == nil || ck.cp == nil {
+		return set
+	}
+	return func(q *corpus.Quarantined) error {
+		if err := set(q); err != nil {
+			return err
+		}
+		return ck.cp.Quarantine(q.Line)
+	}
+}
+
+// emit records each record as finished once emit has written it out.
+func (ck *checkpointFlags) emit(emit func(*corpus.Record, interface{}) error) func(*corpus.Record, interface{}) error {
+	if ck == nil || ck.cp == nil {
+		return emit
+	}
+	return func(rec *corpus.Record, res interface{}) error {
+		if err := emit(rec, res); err != nil {
+			return err
+		}
+		size := int64(0)
+		if ck.out != os.Stdout {
+			var err error
+			if size, err = ck.out.Seek(0, io.SeekCurrent); err != nil {
+				return err
+			}
+		}
+		return ck.cp.Record(rec.Id, size)
+	}
+}
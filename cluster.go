@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/cluster"
+	"github.com/btwiuse/buildahfy/corpus"
+	"github.com/btwiuse/pretty"
+)
+
+// clusterMain groups the corpus into families of near-duplicate
+// Dockerfiles and reports each family's representative and how its
+// members differ from it.
+func clusterMain(args []string) {
+	format, threshold, changes, jobs := "", 0.0, 0, 0
+	fs := flag.NewFlagSet("cluster", flag.ExitOnError)
+	fs.StringVar(&format, "format", "text", "output format: text, json, or records for the representative of each family in the pd json format")
+	fs.Float64Var(&threshold, "threshold", 0.7, "estimated similarity, from 0 to 1, above which files are in the same family")
+	fs.IntVar(&changes, "changes", 5, "number of differing instructions to show per family in text output")
+	fs.IntVar(&jobs, "j", runtime.NumCPU(), "number of records to process in parallel")
+	path := addStoreFlag(fs)
+	in := addInputFlags(fs)
+	fs.Parse(args)
+	checkFormat(format, "text", "json", "records")
+
+	docs := []*cluster.Doc{}
+	records := map[string]corpus.Result{}
+	failed := 0
+	st := openStore(*path)
+	defer st.Close()
+	sketch := func(rec *corpus.Record) interface{} {
+		var d *cluster.Doc
+		loadStored(st, bucket("cluster"), rec, &d, func() error {
+			d, _ = cluster.Sketch(rec.Id, strings.NewReader(rec.Contents))
+			return nil
+		})
+		if d != nil {
+			// the stored sketch may be of another record with the same contents
+			d.Id = rec.Id
+		}
+		return d
+	}
+	emit := func(rec *corpus.Record, res interface{}) error {
+		d := res.(*cluster.Doc)
+		if d == nil {
+			failed++
+			return nil
+		}
+		docs = append(docs, d)
+		if format == "records" {
+			records[rec.Id] = rec.Result
+		}
+		return nil
+	}
+	if err := in.mapRecords(nil, jobs, sketch, emit); err != nil {
+		mapFailed(err)
+	}
+	families := cluster.Cluster(docs, threshold)
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		for _, f := range families {
+			if err := enc.Encode(f); err != nil {
+				log.Fatal(err)
+			}
+		}
+	case "records":
+		for _, f := range families {
+			pretty.Json(records[f.Representative])
+		}
+	case "text":
+		singletons := 0
+		for i, f := range families {
+			if len(f.Members) == 1 {
+				singletons++
+				continue
+			}
+			fmt.Printf("family %d: %d files, representative %s\n", i+1, len(f.Members), f.Representative)
+			for _, c := range head(f.Removed, changes) {
+				fmt.Printf("  - %d lack  %s\n", c.Members, c.Instruction)
+			}
+			for _, c := range head(f.Added, changes) {
+				fmt.Printf("  + %d add   %s\n", c.Members, c.Instruction)
+			}
+		}
+		fmt.Printf("%d files in %d families, %d without near-duplicates, %d failed to parse\n", len(docs), len(families), singletons, failed)
+	}
+}
+
+func head(changes []cluster.Change, n int) []cluster.Change {
+	if len(changes) > n {
+		return changes[:n]
+	}
+	return changes
+}
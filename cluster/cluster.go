@@ -0,0 +1,138 @@
+package cluster
+
+import (
+	"sort"
+)
+
+// bucketLimit caps how many earlier documents of one LSH bucket a new
+// document is compared with.
+const bucketLimit = 32
+
+// Family is a group of near-duplicate Dockerfiles.
+type Family struct {
+	Representative string   `json:"representative"`
+	Members        []string `json:"members"`
+	// Added and Removed are the instructions members have that the
+	// representative lacks, and the other way around, most common first.
+	Added   []Change `json:"added"`
+	Removed []Change `json:"removed"`
+}
+
+// Change is an instruction and how many members differ by it.
+type Change struct {
+	Instruction string `json:"instruction"`
+	Members     int    `json:"members"`
+}
+
+// Cluster groups docs whose estimated similarity is at least threshold,
+// directly or through other members. Families are ordered by size, and
+// singletons are families too.
+func Cluster(docs []*Doc, threshold float64) []*Family {
+	parent := make([]int, len(docs))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	buckets := map[uint64][]int{}
+	for i, d := range docs {
+		for b := 0; b < bands; b++ {
+			key := d.band(b)
+			for _, j := range buckets[key] {
+				if find(i) != find(j) && Similarity(d, docs[j]) >= threshold {
+					parent[find(i)] = find(j)
+				}
+			}
+			if len(buckets[key]) < bucketLimit {
+				buckets[key] = append(buckets[key], i)
+			}
+		}
+	}
+
+	groups := map[int][]*Doc{}
+	roots := []int{}
+	for i, d := range docs {
+		r := find(i)
+		if _, ok := groups[r]; !ok {
+			roots = append(roots, r)
+		}
+		groups[r] = append(groups[r], d)
+	}
+	families := []*Family{}
+	for _, r := range roots {
+		families = append(families, family(groups[r]))
+	}
+	sort.SliceStable(families, func(i, j int) bool {
+		return len(families[i].Members) > len(families[j].Members)
+	})
+	return families
+}
+
+// family picks as representative the member closest to the slot-wise
+// most common signature, and summarizes how the others differ from it.
+func family(members []*Doc) *Family {
+	var mode [hashes]uint64
+	for i := range mode {
+		counts := map[uint64]int{}
+		for _, d := range members {
+			counts[d.Signature[i]]++
+			if counts[d.Signature[i]] > counts[mode[i]] {
+				mode[i] = d.Signature[i]
+			}
+		}
+	}
+	center := &Doc{Signature: mode}
+	rep := members[0]
+	for _, d := range members[1:] {
+		if Similarity(d, center) > Similarity(rep, center) {
+			rep = d
+		}
+	}
+
+	f := &Family{Representative: rep.Id, Added: []Change{}, Removed: []Change{}}
+	inRep := set(rep.Instructions)
+	added, removed := map[string]int{}, map[string]int{}
+	for _, d := range members {
+		f.Members = append(f.Members, d.Id)
+		if d == rep {
+			continue
+		}
+		inDoc := set(d.Instructions)
+		for ins := range inDoc {
+			if !inRep[ins] {
+				added[ins]++
+			}
+		}
+		for ins := range inRep {
+			if !inDoc[ins] {
+				removed[ins]++
+			}
+		}
+	}
+	f.Added, f.Removed = changes(added), changes(removed)
+	return f
+}
+
+func set(instructions []string) map[string]bool {
+	s := map[string]bool{}
+	for _, ins := range instructions {
+		s[ins] = true
+	}
+	return s
+}
+
+func changes(counts map[string]int) []Change {
+	out := []Change{}
+	for ins, n := range counts {
+		out = append(out, Change{ins, n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Members > out[j].Members || out[i].Members == out[j].Members && out[i].Instruction < out[j].Instruction
+	})
+	return out
+}
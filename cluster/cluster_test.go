@@ -0,0 +1,85 @@
+package cluster
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func sketch(t *testing.T, id, dockerfile string) *Doc {
+	d, err := Sketch(id, strings.NewReader(dockerfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+const python = `FROM python:3.8-slim
+WORKDIR /app
+COPY requirements.txt .
+RUN pip install --no-cache-dir -r requirements.txt
+COPY . .
+EXPOSE 8000
+CMD ["gunicorn", "app:app"]
+`
+
+func TestSimilarity(t *testing.T) {
+	a := sketch(t, "a", python)
+	if s := Similarity(a, sketch(t, "same", python)); s != 1 {
+		t.Errorf("identical files: similarity %v", s)
+	}
+	// versions and ports are masked, so these still match closely
+	b := sketch(t, "b", strings.Replace(strings.Replace(python, "3.8", "3.11", 1), "8000", "5000", 1))
+	if s := Similarity(a, b); s < 0.9 {
+		t.Errorf("python versions: similarity %v", s)
+	}
+	c := sketch(t, "c", "FROM golang:1.13\nRUN go build -o /bin/app ./cmd/app\nENTRYPOINT [\"/bin/app\"]\n")
+	if s := Similarity(a, c); s > 0.2 {
+		t.Errorf("unrelated files: similarity %v", s)
+	}
+}
+
+func TestCluster(t *testing.T) {
+	docs := []*Doc{
+		sketch(t, "a", python),
+		sketch(t, "go", "FROM golang:1.13\nRUN go build -o /bin/app ./cmd/app\nENTRYPOINT [\"/bin/app\"]\n"),
+		sketch(t, "b", strings.Replace(python, "3.8", "3.9", 1)),
+		sketch(t, "c", python+"USER nobody\n"),
+	}
+	families := Cluster(docs, 0.7)
+	if len(families) != 2 {
+		t.Fatalf("got %d families, want 2", len(families))
+	}
+	f := families[0]
+	if strings.Join(f.Members, " ") != "a b c" {
+		t.Errorf("members %q", f.Members)
+	}
+	if f.Representative != "a" && f.Representative != "b" {
+		t.Errorf("representative %s, want one without the extra USER", f.Representative)
+	}
+	added := map[string]int{}
+	for _, c := range f.Added {
+		added[c.Instruction] = c.Members
+	}
+	if added["USER nobody"] != 1 {
+		t.Errorf("added %+v, want the USER of c", f.Added)
+	}
+	if families[1].Representative != "go" || len(families[1].Members) != 1 {
+		t.Errorf("second family %+v", families[1])
+	}
+}
+
+func TestDocRoundTrip(t *testing.T) {
+	d := sketch(t, "a", python)
+	dt, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := &Doc{}
+	if err := json.Unmarshal(dt, stored); err != nil {
+		t.Fatal(err)
+	}
+	if Similarity(d, stored) != 1 || stored.band(0) != d.band(0) {
+		t.Error("a stored sketch differs")
+	}
+}
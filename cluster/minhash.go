@@ -0,0 +1,120 @@
+// Package cluster groups Dockerfiles into families of near-duplicates,
+// such as files generated from one template with different versions or
+// package lists.
+package cluster
+
+import (
+	"hash/fnv"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+const (
+	// hashes is the length of a signature, split into bands of rows for
+	// locality-sensitive hashing.
+	hashes = 64
+	bands  = 16
+	rows   = hashes / bands
+)
+
+var (
+	whitespace = regexp.MustCompile(`\s+`)
+	digits     = regexp.MustCompile(`[0-9]+`)
+)
+
+// Doc is the sketch of one Dockerfile.
+type Doc struct {
+	Id string
+	// Instructions are the normalized instructions of the file.
+	Instructions []string
+	// Signature is the MinHash of the shingles of the instructions.
+	Signature [hashes]uint64
+}
+
+// Sketch parses a Dockerfile and computes its MinHash signature over
+// word shingles taken within each instruction.
+func Sketch(id string, r io.Reader) (*Doc, error) {
+	res, err := parser.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	d := &Doc{Id: id}
+	for i := range d.Signature {
+		d.Signature[i] = math.MaxUint64
+	}
+	for _, n := range res.AST.Children {
+		words := []string{strings.ToUpper(n.Value)}
+		words = append(words, n.Flags...)
+		for a := n.Next; a != nil; a = a.Next {
+			words = append(words, strings.Fields(whitespace.ReplaceAllString(a.Value, " "))...)
+		}
+		d.Instructions = append(d.Instructions, strings.Join(words, " "))
+		// shingles are the single words and pairs of words of each
+		// instruction, prefixed with its keyword so the same words under
+		// different instructions differ, and with numbers masked so that
+		// versions do not set apart copies of one template
+		keyword := words[0]
+		args := strings.Fields(digits.ReplaceAllString(strings.Join(words[1:], " "), "0"))
+		if len(args) == 0 {
+			d.add(keyword)
+		}
+		for i := range args {
+			d.add(keyword + " " + args[i])
+			if i+1 < len(args) {
+				d.add(keyword + " " + args[i] + " " + args[i+1])
+			}
+		}
+	}
+	return d, nil
+}
+
+func (d *Doc) add(s string) {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	for i := range d.Signature {
+		if v := permute(x, uint64(i)); v < d.Signature[i] {
+			d.Signature[i] = v
+		}
+	}
+}
+
+// permute is the i-th hash function, a seeded 64-bit mix.
+func permute(x, i uint64) uint64 {
+	x ^= (i + 1) * 0x9e3779b97f4a7c15
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Similarity estimates the Jaccard similarity of the shingles of two
+// documents.
+func Similarity(a, b *Doc) float64 {
+	same := 0
+	for i := range a.Signature {
+		if a.Signature[i] == b.Signature[i] {
+			same++
+		}
+	}
+	return float64(same) / hashes
+}
+
+// band hashes one band of a signature.
+func (d *Doc) band(b int) uint64 {
+	h := fnv.New64a()
+	buf := make([]byte, 8)
+	for _, v := range d.Signature[b*rows : (b+1)*rows] {
+		for i := range buf {
+			buf[i] = byte(v >> (8 * uint(i)))
+		}
+		h.Write(buf)
+	}
+	return h.Sum64() ^ uint64(b)
+}
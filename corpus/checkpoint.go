@@ -0,0 +1,163 @@
+package corpus
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Checkpoint records progress through a source in a state file, one
+// JSON line per emitted record, so an interrupted run can resume after
+// the last record it finished.
+type Checkpoint struct {
+	// Offset is the number of records finished.
+	Offset int
+	// Size is the size of the output after the last finished record.
+	Size int64
+
+	mu sync.Mutex
+	f  *os.File
+	// ids are the records finished by the earlier run, and quarantined
+	// the lines of input it set aside; those of this run are only
+	// written to f.
+	ids         []string
+	quarantined map[int]bool
+}
+
+// entry is a finished record, or with Quarantined set a line of input
+// set aside, which leaves the offset as it is.
+type entry struct {
+	Offset      int    `json:"offset"`
+	Id          string `json:"id,omitempty"`
+	Size        int64  `json:"size"`
+	Quarantined int    `json:"quarantined,omitempty"`
+}
+
+// OpenCheckpoint starts a fresh state file at path, or with resume set
+// reads the progress recorded in it and appends to it.
+func OpenCheckpoint(path string, resume bool) (*Checkpoint, error) {
+	if !resume {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		return &Checkpoint{f: f, quarantined: map[int]bool{}}, nil
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	c := &Checkpoint{f: f, quarantined: map[int]bool{}}
+	r := bufio.NewReader(f)
+	var good int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// a torn last line is dropped
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		e := entry{}
+		err = json.Unmarshal(line, &e)
+		switch {
+		case err == nil && e.Quarantined > 0:
+			c.quarantined[e.Quarantined] = true
+		case err == nil && e.Offset == c.Offset+1:
+			c.Offset, c.Size = e.Offset, e.Size
+			c.ids = append(c.ids, e.Id)
+		default:
+			f.Close()
+			return nil, errors.Errorf("%s: bad checkpoint after offset %d", path, c.Offset)
+		}
+		good += int64(len(line))
+	}
+	if err := f.Truncate(good); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(good, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Source skips the records of src that an earlier run finished, checking
+// that their Ids match, so the input must be the same as before. Input
+// src quarantines among them, or that the earlier run recorded as
+// quarantined past them, is dropped, as it was already set aside.
+func (c *Checkpoint) Source(src Source) Source {
+	return &resumed{Source: src, ids: append([]string{}, c.ids...), quarantined: c.quarantined}
+}
+
+type resumed struct {
+	Source
+	ids         []string
+	quarantined map[int]bool
+	skipped     int
+}
+
+func (r *resumed) Next() (*Record, error) {
+	for r.skipped < len(r.ids) {
+		rec, err := r.Source.Next()
+		if err == io.EOF {
+			return nil, errors.Errorf("input ended at record %d, before the checkpoint at %d", r.skipped, len(r.ids))
+		}
+		if _, ok := err.(*Quarantined); ok {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if rec.Id != r.ids[r.skipped] {
+			return nil, errors.Errorf("record %d is %s, the checkpoint has %s; has the input changed?", r.skipped+1, rec.Id, r.ids[r.skipped])
+		}
+		r.skipped++
+	}
+	for {
+		rec, err := r.Source.Next()
+		if q, ok := err.(*Quarantined); ok && r.quarantined[q.Line] {
+			continue
+		}
+		return rec, err
+	}
+}
+
+// Record notes that the record with the given Id is finished and the
+// output has grown to size.
+func (c *Checkpoint) Record(id string, size int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Offset++
+	c.Size = size
+	return c.write(&entry{Offset: c.Offset, Id: id, Size: size})
+}
+
+// Quarantine notes that the input at line was set aside, so that a
+// resumed run does not set it aside again. It may be called while
+// records are being recorded.
+func (c *Checkpoint) Quarantine(line int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.write(&entry{Offset: c.Offset, Size: c.Size, Quarantined: line})
+}
+
+func (c *Checkpoint) write(e *entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = c.f.Write(append(line, '\n'))
+	return err
+}
+
+func (c *Checkpoint) Close() error {
+	return c.f.Close()
+}
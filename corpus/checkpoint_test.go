@@ -0,0 +1,216 @@
+package corpus
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pd returns a pd JSON stream of records with the given Ids.
+func pd(ids ...string) string {
+	lines := []string{}
+	for _, id := range ids {
+		value, _ := json.Marshal(&Response{Contents: "FROM " + id + "\n"})
+		line, _ := json.Marshal(&Result{Id: id, Value: string(value)})
+		lines = append(lines, string(line))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func tempState(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "state"), func() { os.RemoveAll(dir) }
+}
+
+func ids(t *testing.T, src Source) []string {
+	got := []string{}
+	for {
+		rec, err := src.Next()
+		if err == io.EOF {
+			return got
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, rec.Id)
+	}
+}
+
+func TestCheckpointResume(t *testing.T) {
+	path, cleanup := tempState(t)
+	defer cleanup()
+
+	c, err := OpenCheckpoint(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, id := range []string{"a", "b"} {
+		if err := c.Record(id, int64(10*(i+1))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Close()
+
+	c, err = OpenCheckpoint(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.Offset != 2 || c.Size != 20 {
+		t.Fatalf("loaded offset %d size %d", c.Offset, c.Size)
+	}
+	src := c.Source(NewStream(strings.NewReader(pd("a", "b", "c", "d"))))
+	got := []string{}
+	for {
+		rec, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, rec.Id)
+		// recording while reading must not disturb the skipping
+		if err := c.Record(rec.Id, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if strings.Join(got, " ") != "c d" {
+		t.Errorf("resumed records %q, want c d", got)
+	}
+}
+
+func TestCheckpointFreshRecordsDoNotSkip(t *testing.T) {
+	path, cleanup := tempState(t)
+	defer cleanup()
+
+	c, err := OpenCheckpoint(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	src := c.Source(NewStream(strings.NewReader(pd("a", "b", "c"))))
+	rec, err := src.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Record(rec.Id, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(t, src); strings.Join(got, " ") != "b c" {
+		t.Errorf("records %q, want b c", got)
+	}
+}
+
+func TestCheckpointChangedInput(t *testing.T) {
+	path, cleanup := tempState(t)
+	defer cleanup()
+
+	c, err := OpenCheckpoint(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Record("a", 0)
+	c.Close()
+
+	c, err = OpenCheckpoint(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	src := c.Source(NewStream(strings.NewReader(pd("x", "b"))))
+	if _, err := src.Next(); err == nil || !strings.Contains(err.Error(), "has the input changed") {
+		t.Errorf("got %v, want a changed input error", err)
+	}
+}
+
+func TestCheckpointTornLine(t *testing.T) {
+	path, cleanup := tempState(t)
+	defer cleanup()
+
+	state := `{"offset":1,"id":"a","size":3}` + "\n" + `{"offset":2,"id":"b"`
+	if err := ioutil.WriteFile(path, []byte(state), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := OpenCheckpoint(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.Offset != 1 {
+		t.Errorf("offset %d, want the torn line dropped", c.Offset)
+	}
+}
+
+func TestCheckpointResumeDropsQuarantined(t *testing.T) {
+	path, cleanup := tempState(t)
+	defer cleanup()
+
+	c, err := OpenCheckpoint(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Record("a", 0)
+	c.Record("b", 0)
+	c.Close()
+
+	c, err = OpenCheckpoint(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	input := pd("a") + "not json\n" + pd("b") + "{\n" + pd("c")
+	quarantined := []int{}
+	src := Skip(c.Source(NewStream(strings.NewReader(input))), func(q *Quarantined) error {
+		quarantined = append(quarantined, q.Line)
+		return nil
+	})
+	if got := ids(t, src); strings.Join(got, " ") != "c" {
+		t.Errorf("resumed records %q, want c", got)
+	}
+	if len(quarantined) != 1 || quarantined[0] != 4 {
+		t.Errorf("quarantined lines %v, want only 4 past the checkpoint", quarantined)
+	}
+}
+
+func TestCheckpointResumeKeepsQuarantinedOnce(t *testing.T) {
+	path, cleanup := tempState(t)
+	defer cleanup()
+
+	// the first run set line 2 aside and stopped before finishing b
+	c, err := OpenCheckpoint(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Record("a", 5)
+	c.Quarantine(2)
+	c.Close()
+
+	c, err = OpenCheckpoint(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.Offset != 1 || c.Size != 5 {
+		t.Fatalf("loaded offset %d size %d, want 1 and 5", c.Offset, c.Size)
+	}
+	input := pd("a") + "not json\n" + pd("b") + "{\n" + pd("c")
+	quarantined := []int{}
+	src := Skip(c.Source(NewStream(strings.NewReader(input))), func(q *Quarantined) error {
+		quarantined = append(quarantined, q.Line)
+		return nil
+	})
+	if got := ids(t, src); strings.Join(got, " ") != "b c" {
+		t.Errorf("resumed records %q, want b c", got)
+	}
+	if len(quarantined) != 1 || quarantined[0] != 4 {
+		t.Errorf("quarantined lines %v, want only 4, which the first run did not reach", quarantined)
+	}
+}
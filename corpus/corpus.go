@@ -0,0 +1,58 @@
+// Package corpus reads the Dockerfile corpus, a JSON stream of
+// {Id, Value} records whose Value is itself a JSON string holding
+// {Contents}.
+package corpus
+
+import (
+	"encoding/json"
+	"io"
+)
+
+type Result struct {
+	Id    string
+	Value string
+}
+
+type Response struct {
+	Contents string
+}
+
+// Record is one Dockerfile of the corpus.
+type Record struct {
+	Result
+	Contents string
+}
+
+// Source yields records until it returns io.EOF.
+type Source interface {
+	Next() (*Record, error)
+}
+
+type stream struct {
+	lines *lines
+}
+
+// NewStream reads records from a pd JSON stream. Records that do not
+// decode are returned as *Quarantined errors.
+func NewStream(r io.Reader) Source {
+	return &stream{lines: newLines(r)}
+}
+
+func (s *stream) Next() (*Record, error) {
+	dt, line, err := s.lines.next()
+	if err != nil {
+		return nil, err
+	}
+	rec := &Record{}
+	if err := json.Unmarshal(dt, &rec.Result); err != nil {
+		return nil, &Quarantined{Line: line, Reason: "value", Err: err.Error(), Raw: string(dt)}
+	}
+	c := &Response{}
+	if err := json.Unmarshal([]byte(rec.Value), c); err != nil {
+		q := rec.Quarantine("value", err)
+		q.Line = line
+		return nil, q
+	}
+	rec.Contents = c.Contents
+	return rec, nil
+}
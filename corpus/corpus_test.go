@@ -0,0 +1,35 @@
+package corpus
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	input := pd("a") +
+		`{"Id":"b","Value":"not json"}` + "\n" +
+		`["not","a","record"]` + "\n" +
+		pd("c")
+	src := NewStream(strings.NewReader(input))
+
+	rec, err := src.Next()
+	if err != nil || rec.Id != "a" || rec.Contents != "FROM a\n" {
+		t.Fatalf("got %+v %v, want a and its contents", rec, err)
+	}
+	// a Value that does not decode is set aside with its Id, a record
+	// that does not decode with its line
+	for _, want := range []Quarantined{{Id: "b", Line: 2}, {Line: 3}} {
+		_, err := src.Next()
+		q, ok := err.(*Quarantined)
+		if !ok || q.Reason != "value" || q.Id != want.Id || q.Line != want.Line {
+			t.Errorf("got %v, want a value quarantine of %+v", err, want)
+		}
+	}
+	if rec, err := src.Next(); err != nil || rec.Id != "c" {
+		t.Errorf("got %+v %v, want c", rec, err)
+	}
+	if _, err := src.Next(); err != io.EOF {
+		t.Errorf("got %v at the end, want io.EOF", err)
+	}
+}
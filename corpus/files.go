@@ -0,0 +1,117 @@
+package corpus
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// IsDockerfile reports whether a file name looks like a Dockerfile or
+// Containerfile: Dockerfile, Dockerfile.dev, app.dockerfile and so on.
+func IsDockerfile(name string) bool {
+	base := strings.ToLower(path.Base(filepath.ToSlash(name)))
+	for _, stem := range []string{"dockerfile", "containerfile"} {
+		if base == stem || strings.HasPrefix(base, stem+".") || strings.HasSuffix(base, "."+stem) {
+			return true
+		}
+	}
+	return false
+}
+
+// newRecord builds a record for inputs other than the pd stream, with a
+// Value in the pd encoding so the record can be written back out as one.
+func newRecord(id, contents string) (*Record, error) {
+	value, err := json.Marshal(&Response{Contents: contents})
+	if err != nil {
+		return nil, err
+	}
+	return &Record{Result: Result{Id: id, Value: string(value)}, Contents: contents}, nil
+}
+
+type dir struct {
+	root  string
+	files []string
+}
+
+// NewDir reads every Dockerfile below root, in lexical order. Record Ids
+// are slash-separated paths relative to root.
+func NewDir(root string) (Source, error) {
+	d := &dir{root: root}
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if info.Mode().IsRegular() && IsDockerfile(p) {
+			d.files = append(d.files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(d.files)
+	return d, nil
+}
+
+func (d *dir) Next() (*Record, error) {
+	if len(d.files) == 0 {
+		return nil, io.EOF
+	}
+	p := d.files[0]
+	d.files = d.files[1:]
+	dt, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(d.root, p)
+	if err != nil {
+		return nil, err
+	}
+	return newRecord(filepath.ToSlash(rel), string(dt))
+}
+
+type archive struct {
+	tr *tar.Reader
+}
+
+// NewTar reads every Dockerfile in a tar archive, which may be gzipped.
+// Record Ids are the entry names.
+func NewTar(r io.Reader) (Source, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return &archive{tr: tar.NewReader(zr)}, nil
+	}
+	return &archive{tr: tar.NewReader(br)}, nil
+}
+
+func (a *archive) Next() (*Record, error) {
+	for {
+		hdr, err := a.tr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA || !IsDockerfile(hdr.Name) {
+			continue
+		}
+		dt, err := ioutil.ReadAll(a.tr)
+		if err != nil {
+			return nil, err
+		}
+		return newRecord(strings.TrimPrefix(hdr.Name, "./"), string(dt))
+	}
+}
@@ -0,0 +1,54 @@
+package corpus
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type history struct {
+	repo     string
+	versions []string
+}
+
+// NewGit reads every version of every Dockerfile in the history of the
+// git repository at repo, oldest first. Record Ids are "<commit>:<path>".
+// It needs the git command.
+func NewGit(repo string) (Source, error) {
+	cmd := exec.Command("git", "-C", repo, "-c", "core.quotePath=false", "log", "--all", "--reverse", "--no-renames",
+		"--diff-filter=AM", "--name-only", "--format=commit %H")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrap(err, "git log")
+	}
+	h := &history{repo: repo}
+	commit := ""
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "commit "):
+			commit = strings.TrimPrefix(line, "commit ")
+		case line != "" && IsDockerfile(line):
+			h.versions = append(h.versions, commit+":"+line)
+		}
+	}
+	return h, scanner.Err()
+}
+
+func (h *history) Next() (*Record, error) {
+	if len(h.versions) == 0 {
+		return nil, io.EOF
+	}
+	version := h.versions[0]
+	h.versions = h.versions[1:]
+	dt, err := exec.Command("git", "-C", h.repo, "show", version).Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "git show %s", version)
+	}
+	return newRecord(version, string(dt))
+}
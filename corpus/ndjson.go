@@ -0,0 +1,92 @@
+package corpus
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type ndjson struct {
+	lines    *lines
+	id       []string
+	contents []string
+}
+
+// NewNDJSON reads a stream of JSON objects, taking the Id and contents
+// of each record from dotted field paths such as "meta.sha" or
+// "Value.Contents". A string met halfway along a path is decoded as
+// JSON, so the pd stream is NewNDJSON(r, "Id", "Value.Contents").
+// Records that do not decode are returned as *Quarantined errors.
+func NewNDJSON(r io.Reader, idPath, contentsPath string) Source {
+	return &ndjson{
+		lines:    newLines(r),
+		id:       strings.Split(idPath, "."),
+		contents: strings.Split(contentsPath, "."),
+	}
+}
+
+func (s *ndjson) Next() (*Record, error) {
+	dt, line, err := s.lines.next()
+	if err != nil {
+		return nil, err
+	}
+	var obj interface{}
+	if err := decode(dt, &obj); err != nil {
+		return nil, &Quarantined{Line: line, Reason: "json", Err: err.Error(), Raw: string(dt)}
+	}
+	id, err := lookup(obj, s.id)
+	if err != nil {
+		return nil, &Quarantined{Line: line, Reason: "value", Err: err.Error(), Raw: string(dt)}
+	}
+	contents, err := lookup(obj, s.contents)
+	if err != nil {
+		return nil, &Quarantined{Id: id, Line: line, Reason: "value", Err: err.Error(), Raw: string(dt)}
+	}
+	return newRecord(id, contents)
+}
+
+// lookup follows path through obj and returns the value it ends at as a
+// string.
+func lookup(obj interface{}, path []string) (string, error) {
+	for i, field := range path {
+		if s, ok := obj.(string); ok {
+			if err := decode([]byte(s), &obj); err != nil {
+				return "", errors.Wrapf(err, "field %s", strings.Join(path[:i], "."))
+			}
+		}
+		m, ok := obj.(map[string]interface{})
+		if !ok {
+			return "", errors.Errorf("field %s is not an object", strings.Join(path[:i], "."))
+		}
+		if obj, ok = m[field]; !ok {
+			return "", errors.Errorf("no field %s", strings.Join(path[:i+1], "."))
+		}
+	}
+	switch v := obj.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return fmt.Sprint(v), nil
+	}
+	return "", errors.Errorf("field %s is not a string", strings.Join(path, "."))
+}
+
+// decode unmarshals dt keeping numbers as written, so that an Id such as
+// 123456789 is not turned into 1.23456789e+08.
+func decode(dt []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(dt))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("invalid input after top-level value")
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package corpus
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNDJSONNumericId(t *testing.T) {
+	input := `{"id":123456789,"dockerfile":"FROM a"}
+{"meta":{"n":12.5,"ok":true},"dockerfile":"FROM b"}
+`
+	src := NewNDJSON(strings.NewReader(input), "id", "dockerfile")
+	rec, err := src.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Id != "123456789" || rec.Contents != "FROM a" {
+		t.Errorf("got %q %q", rec.Id, rec.Contents)
+	}
+
+	for path, want := range map[string]string{"meta.n": "12.5", "meta.ok": "true"} {
+		src := NewNDJSON(strings.NewReader(input), path, "dockerfile")
+		src.Next()
+		rec, err := src.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Id != want {
+			t.Errorf("%s: got %q, want %q", path, rec.Id, want)
+		}
+	}
+}
+
+func TestNDJSONNestedString(t *testing.T) {
+	src := NewNDJSON(strings.NewReader(pd("a")), "Id", "Value.Contents")
+	rec, err := src.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Id != "a" || rec.Contents != "FROM a\n" {
+		t.Errorf("got %q %q", rec.Id, rec.Contents)
+	}
+}
+
+func TestNDJSONQuarantine(t *testing.T) {
+	input := `{"id":"a"}` + "\n" + `{"id":"b","dockerfile":"FROM b"}` + "\n"
+	src := NewNDJSON(strings.NewReader(input), "id", "dockerfile")
+	_, err := src.Next()
+	q, ok := err.(*Quarantined)
+	if !ok || q.Reason != "value" || q.Id != "a" || q.Line != 1 {
+		t.Fatalf("got %v, want a value quarantine of a", err)
+	}
+	rec, err := src.Next()
+	if err != nil || rec.Id != "b" {
+		t.Errorf("got %v %v, want b after the quarantined record", rec, err)
+	}
+}
@@ -0,0 +1,101 @@
+package corpus
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// Map runs fn on the records of src with the given number of workers and
+// passes each record and its result to emit in input order. At most
+// twice as many records as workers are held in memory at once. Map stops
+// at the end of src, at the first error from src or emit, or when ctx is
+// cancelled, returning ctx.Err() then without waiting for src.
+func Map(ctx context.Context, src Source, workers int, fn func(*Record) interface{}, emit func(*Record, interface{}) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+
+	type job struct {
+		rec    *Record
+		result chan interface{}
+	}
+	jobs := make(chan job)
+	pending := make(chan job, 2*workers)
+	var readErr error
+
+	go func() {
+		defer close(pending)
+		defer close(jobs)
+		for {
+			rec, err := src.Next()
+			if err != nil {
+				if err != io.EOF {
+					readErr = err
+				}
+				return
+			}
+			j := job{rec: rec, result: make(chan interface{}, 1)}
+			select {
+			case pending <- j:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- j:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case j, ok := <-jobs:
+					if !ok {
+						return
+					}
+					j.result <- fn(j.rec)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	// the reader is not waited for: it may be blocked in src.Next, on
+	// an idle terminal say, and is left to end with the process
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	for {
+		var j job
+		select {
+		case next, ok := <-pending:
+			if !ok {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				return readErr
+			}
+			j = next
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		select {
+		case res := <-j.result:
+			if err := emit(j.rec, res); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package corpus
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMapKeepsOrder(t *testing.T) {
+	ids := []string{}
+	for i := 0; i < 50; i++ {
+		ids = append(ids, strconv.Itoa(i))
+	}
+	src := NewStream(strings.NewReader(pd(ids...)))
+	slow := func(rec *Record) interface{} {
+		// the early records finish last
+		n, _ := strconv.Atoi(rec.Id)
+		time.Sleep(time.Duration(50-n) * 100 * time.Microsecond)
+		return rec.Id
+	}
+	got := []string{}
+	emit := func(rec *Record, res interface{}) error {
+		if res.(string) != rec.Id {
+			t.Errorf("record %s has the result of %s", rec.Id, res)
+		}
+		got = append(got, rec.Id)
+		return nil
+	}
+	if err := Map(context.Background(), src, 8, slow, emit); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, " ") != strings.Join(ids, " ") {
+		t.Errorf("emitted %v", got)
+	}
+}
+
+// stuck is a source that never returns, like stdin left open.
+type stuck struct{}
+
+func (stuck) Next() (*Record, error) {
+	select {}
+}
+
+func TestMapCancelWithIdleSource(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Map(ctx, stuck{}, 4, func(*Record) interface{} { return nil }, nil)
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("got %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Map did not return after cancel")
+	}
+}
@@ -0,0 +1,183 @@
+package corpus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// Quarantined is a record set aside instead of processed, with the
+// reason: json for input that is not JSON, value for a record whose
+// fields do not decode, panic, timeout, or error for a record the
+// processing rejected. As an error it is returned by sources for bad
+// input, which can carry on past it.
+type Quarantined struct {
+	Id     string `json:"id,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Reason string `json:"reason"`
+	Err    string `json:"error"`
+	// Raw is the input that did not decode, and Value the pd Value of a
+	// record that did.
+	Raw   string `json:"raw,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+func (q *Quarantined) Error() string {
+	if q.Id != "" {
+		return fmt.Sprintf("%s: %s: %s", q.Id, q.Reason, q.Err)
+	}
+	return fmt.Sprintf("line %d: %s: %s", q.Line, q.Reason, q.Err)
+}
+
+// Quarantine sets rec aside for the given reason.
+func (rec *Record) Quarantine(reason string, err error) *Quarantined {
+	return &Quarantined{Id: rec.Id, Reason: reason, Err: err.Error(), Value: rec.Value}
+}
+
+// Skip passes the records of src through, handing the ones it
+// quarantines to set and reading on.
+func Skip(src Source, set func(*Quarantined) error) Source {
+	return &skip{src, set}
+}
+
+type skip struct {
+	Source
+	set func(*Quarantined) error
+}
+
+func (s *skip) Next() (*Record, error) {
+	for {
+		rec, err := s.Source.Next()
+		q, ok := err.(*Quarantined)
+		if !ok {
+			return rec, err
+		}
+		if err := s.set(q); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Guard wraps fn so that a record that panics, or that takes longer than
+// timeout when timeout is positive, yields a *Quarantined result instead.
+// A record that times out is abandoned, not stopped: its goroutine runs
+// on in the background.
+func Guard(fn func(*Record) interface{}, timeout time.Duration) func(*Record) interface{} {
+	return func(rec *Record) interface{} {
+		done := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					done <- rec.Quarantine("panic", fmt.Errorf("%v", r))
+				}
+			}()
+			done <- fn(rec)
+		}()
+		if timeout <= 0 {
+			return <-done
+		}
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case res := <-done:
+			return res
+		case <-timer.C:
+			return rec.Quarantine("timeout", fmt.Errorf("no result after %s", timeout))
+		}
+	}
+}
+
+// lines splits a stream into JSON values, normally one per line. A value
+// may span lines, and a line may hold several values, as json.Decoder
+// reads them; a line that is not JSON, or does not complete the value
+// begun on the lines before it, is returned as a *Quarantined error from
+// where the values before it end, and reading resumes on the next line.
+type lines struct {
+	r       *bufio.Reader
+	line    int
+	pending []pendingLine
+}
+
+type pendingLine struct {
+	n    int
+	text []byte
+}
+
+func newLines(r io.Reader) *lines {
+	return &lines{r: bufio.NewReader(r)}
+}
+
+func (l *lines) readLine() (pendingLine, error) {
+	if len(l.pending) > 0 {
+		p := l.pending[0]
+		l.pending = l.pending[1:]
+		return p, nil
+	}
+	text, err := l.r.ReadBytes('\n')
+	if err == io.EOF && len(text) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return pendingLine{}, err
+	}
+	l.line++
+	return pendingLine{l.line, text}, nil
+}
+
+// next returns the next value and the line it starts on.
+func (l *lines) next() ([]byte, int, error) {
+	read := []pendingLine{}
+	buf := []byte{}
+	for {
+		p, err := l.readLine()
+		if err == io.EOF && len(read) > 0 {
+			return nil, 0, &Quarantined{Line: read[0].n, Reason: "json", Err: "unexpected end of input", Raw: string(buf)}
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(read) == 0 && len(bytes.TrimSpace(p.text)) == 0 {
+			continue
+		}
+		read = append(read, p)
+		buf = append(buf, p.text...)
+		var v interface{}
+		err = json.Unmarshal(buf, &v)
+		if err == nil {
+			return buf, read[0].n, nil
+		}
+		if err.Error() == "unexpected end of JSON input" {
+			// the value goes on past this line
+			continue
+		}
+		if rest, ok := after(buf); ok {
+			// the value ends on this line, which goes on with more
+			last := read[len(read)-1]
+			l.pending = append([]pendingLine{{last.n, rest}}, l.pending...)
+			return buf[:len(buf)-len(rest)], read[0].n, nil
+		}
+		// set aside the first line and read the rest again
+		l.pending = append(read[1:], l.pending...)
+		return nil, 0, &Quarantined{Line: read[0].n, Reason: "json", Err: err.Error(), Raw: string(read[0].text)}
+	}
+}
+
+// after returns what follows the first value in buf, if buf starts with
+// a complete value.
+func after(buf []byte) ([]byte, bool) {
+	r := bytes.NewReader(buf)
+	dec := json.NewDecoder(r)
+	var v json.RawMessage
+	if err := dec.Decode(&v); err != nil {
+		return nil, false
+	}
+	rest, err := ioutil.ReadAll(io.MultiReader(dec.Buffered(), r))
+	if err != nil {
+		return nil, false
+	}
+	return rest, true
+}
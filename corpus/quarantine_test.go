@@ -0,0 +1,72 @@
+package corpus
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLines(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"one per line", "1\n{\"a\":2}\n", []string{"1@1", `{"a":2}@2`}},
+		{"blank lines", "\n1\n\n  \n2", []string{"1@2", "2@5"}},
+		{"spanning lines", "{\"a\":\n1}\n2\n", []string{"{\"a\":\n1}@1", "2@3"}},
+		{"several on a line", "1 2 {\"a\":3}\n4\n", []string{"1@1", "2@1", `{"a":3}@1`, "4@2"}},
+		{"ending across lines", "{\"a\":\n1} 2\n3\n", []string{"{\"a\":\n1}@1", "2@2", "3@3"}},
+		{"garbage", "x\n1\n", []string{"quarantined@1", "1@2"}},
+		{"garbage after a value", "1 x 2\n3\n", []string{"1@1", "quarantined@1", "3@2"}},
+		{"unfinished value", "{\"a\":\nx\n1\n", []string{"quarantined@1", "quarantined@2", "1@3"}},
+		{"truncated input", "1\n{\"a\":", []string{"1@1", "quarantined@2"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := newLines(strings.NewReader(tc.input))
+			got := []string{}
+			for {
+				v, line, err := l.next()
+				if err == io.EOF {
+					break
+				}
+				if q, ok := err.(*Quarantined); ok {
+					got = append(got, fmt.Sprintf("quarantined@%d", q.Line))
+					continue
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, fmt.Sprintf("%s@%d", strings.TrimSpace(string(v)), line))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGuard(t *testing.T) {
+	fn := Guard(func(rec *Record) interface{} {
+		switch rec.Id {
+		case "panic":
+			panic("boom")
+		case "slow":
+			time.Sleep(time.Second)
+		}
+		return rec.Id
+	}, 50*time.Millisecond)
+
+	if res := fn(&Record{Result: Result{Id: "ok"}}); res != "ok" {
+		t.Errorf("got %v, want the result of fn", res)
+	}
+	for id, reason := range map[string]string{"panic": "panic", "slow": "timeout"} {
+		q, ok := fn(&Record{Result: Result{Id: id}}).(*Quarantined)
+		if !ok || q.Id != id || q.Reason != reason {
+			t.Errorf("%s: got %v, want a %s quarantine", id, q, reason)
+		}
+	}
+}
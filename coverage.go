@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/corpus"
+	"github.com/btwiuse/buildahfy/coverage"
+	"github.com/btwiuse/buildahfy/translate"
+)
+
+// coverageMain translates the corpus and reports how many files and
+// instructions were translated, skipped, stubbed or dropped flags.
+func coverageMain(args []string) {
+	format, jobs := "", 0
+	fs := flag.NewFlagSet("coverage", flag.ExitOnError)
+	fs.StringVar(&format, "format", "text", "output format: text or json")
+	fs.IntVar(&jobs, "j", runtime.NumCPU(), "number of records to process in parallel")
+	path := addStoreFlag(fs)
+	in := addInputFlags(fs)
+	fs.Parse(args)
+	checkFormat(format, "text", "json")
+
+	st := openStore(*path)
+	defer st.Close()
+	report := coverage.NewReport()
+	check := func(rec *corpus.Record) interface{} {
+		var f *coverage.File
+		loadStored(st, bucket("coverage", "translate="+translate.Version), rec, &f, func() error {
+			f, _ = coverage.Check(strings.NewReader(rec.Contents))
+			return nil
+		})
+		return f
+	}
+	emit := func(rec *corpus.Record, res interface{}) error {
+		report.Add(res.(*coverage.File))
+		return nil
+	}
+	if err := in.mapRecords(nil, jobs, check, emit); err != nil {
+		mapFailed(err)
+	}
+
+	var err error
+	switch format {
+	case "text":
+		err = report.WriteText(os.Stdout)
+	case "json":
+		err = report.WriteJSON(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,174 @@
+// Package coverage measures how much of a corpus the translator handles.
+package coverage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/step"
+	"github.com/btwiuse/buildahfy/translate"
+)
+
+// File is the outcome of translating every step of one Dockerfile.
+type File struct {
+	Steps []step.Step `json:"-"`
+	// Instructions are the keywords of the steps, such as RUN, so that a
+	// stored File can be counted without its steps.
+	Instructions []string
+	Outcomes     []translate.Outcome
+	// Panic is set if parsing the file panicked.
+	Panic string
+}
+
+// Check parses and translates a Dockerfile. It returns an error if the
+// file does not parse.
+func Check(r io.Reader) (f *File, err error) {
+	f = &File{}
+	defer func() {
+		if r := recover(); r != nil {
+			f, err = &File{Panic: fmt.Sprint(r)}, nil
+		}
+	}()
+	if f.Steps, err = step.Parse(r); err != nil {
+		return nil, err
+	}
+	for _, s := range f.Steps {
+		f.Instructions = append(f.Instructions, strings.ToUpper(s.Node.Value))
+		f.Outcomes = append(f.Outcomes, translate.Check(s))
+	}
+	return f, nil
+}
+
+// statuses are the per-file categories, in report order; a file counts
+// as translated only if no step hit any of the others.
+var statuses = []translate.Status{
+	translate.Translated,
+	translate.Placeholder,
+	translate.Unsupported,
+	translate.Panicked,
+}
+
+// Flag counts the uses of one flag of one instruction.
+type Flag struct {
+	Supported bool `json:"supported"`
+	Total     int  `json:"total"`
+	Files     int  `json:"files"`
+}
+
+// Report aggregates coverage over a corpus.
+type Report struct {
+	Files  int `json:"files"`
+	Failed int `json:"failed"`
+	// Statuses counts files by the statuses their steps reached.
+	Statuses map[translate.Status]int `json:"statuses"`
+	// Instructions counts steps by instruction and status.
+	Instructions map[string]map[translate.Status]int `json:"instructions"`
+	// Flags is keyed by instruction and flag, such as "RUN --mount".
+	Flags map[string]*Flag `json:"flags"`
+}
+
+func NewReport() *Report {
+	return &Report{
+		Statuses:     map[translate.Status]int{},
+		Instructions: map[string]map[translate.Status]int{},
+		Flags:        map[string]*Flag{},
+	}
+}
+
+// Add counts one file; a nil file counts as one that failed to parse.
+func (rep *Report) Add(f *File) {
+	rep.Files++
+	if f == nil {
+		rep.Failed++
+		return
+	}
+	if f.Panic != "" {
+		rep.Statuses[translate.Panicked]++
+		return
+	}
+	seen := map[translate.Status]bool{}
+	flags := map[string]bool{}
+	for i, out := range f.Outcomes {
+		name := f.Instructions[i]
+		if rep.Instructions[name] == nil {
+			rep.Instructions[name] = map[translate.Status]int{}
+		}
+		rep.Instructions[name][out.Status]++
+		seen[out.Status] = true
+		dropped := map[string]bool{}
+		for _, flag := range out.Dropped {
+			dropped[flag] = true
+		}
+		for _, flag := range out.Flags {
+			key := name + " " + flag
+			fl, ok := rep.Flags[key]
+			if !ok {
+				fl = &Flag{Supported: !dropped[flag]}
+				rep.Flags[key] = fl
+			}
+			fl.Total++
+			if !flags[key] {
+				fl.Files++
+				flags[key] = true
+			}
+		}
+	}
+	for status := range seen {
+		if status != translate.Translated {
+			rep.Statuses[status]++
+		}
+	}
+	if len(seen) == 1 && seen[translate.Translated] || len(seen) == 0 {
+		rep.Statuses[translate.Translated]++
+	}
+}
+
+func (rep *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rep)
+}
+
+func (rep *Report) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "%d files, %d failed to parse\n\n", rep.Files, rep.Failed)
+	for _, status := range statuses {
+		fmt.Fprintf(w, "%-24s %8d files\n", status, rep.Statuses[status])
+	}
+
+	fmt.Fprintf(w, "\n%-16s", "instruction")
+	for _, status := range statuses {
+		fmt.Fprintf(w, " %12s", status)
+	}
+	fmt.Fprintln(w)
+	for _, name := range sortedKeys(rep.Instructions) {
+		fmt.Fprintf(w, "%-16s", name)
+		for _, status := range statuses {
+			fmt.Fprintf(w, " %12d", rep.Instructions[name][status])
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "\n%-32s %10s %10s %10s\n", "flag", "supported", "total", "files")
+	keys := []string{}
+	for k := range rep.Flags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fl := rep.Flags[k]
+		fmt.Fprintf(w, "%-32s %10t %10d %10d\n", k, fl.Supported, fl.Total, fl.Files)
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]map[translate.Status]int) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"runtime"
+
+	"github.com/btwiuse/buildahfy/corpus"
+	"github.com/btwiuse/buildahfy/dedup"
+	"github.com/btwiuse/pretty"
+	"github.com/opencontainers/go-digest"
+)
+
+// dedupMain prints one record per fingerprint of the corpus, optionally
+// writing every group of duplicates to a file.
+func dedupMain(args []string) {
+	policy, groups, jobs := "", "", 0
+	fs := flag.NewFlagSet("dedup", flag.ExitOnError)
+	fs.StringVar(&policy, "canonical", "first", "record to keep of each group: first, shortest or formatted")
+	fs.StringVar(&groups, "groups", "", "write the Ids of each fingerprint to `file` as ndjson")
+	fs.IntVar(&jobs, "j", runtime.NumCPU(), "number of records to process in parallel")
+	path := addStoreFlag(fs)
+	in := addInputFlags(fs)
+	fs.Parse(args)
+
+	index, err := dedup.NewIndex(dedup.Policy(policy))
+	if err != nil {
+		log.Fatal(err)
+	}
+	st := openStore(*path)
+	defer st.Close()
+	key := func(rec *corpus.Record) interface{} {
+		k := &dedup.Key{}
+		loadStored(st, bucket("dedup", policy), rec, k, func() error {
+			*k = *index.Key(rec.Contents)
+			return nil
+		})
+		return k
+	}
+	// the first record of a group is final and printed at once; under
+	// other policies a later one may replace it, so the records are
+	// spooled to disk rather than held until the end
+	first := dedup.Policy(policy) == dedup.First
+	sp := newSpool()
+	defer sp.Close()
+	emit := func(rec *corpus.Record, res interface{}) error {
+		k := res.(*dedup.Key)
+		if !index.Add(rec.Id, k) {
+			return nil
+		}
+		if first {
+			pretty.Json(rec.Result)
+			return nil
+		}
+		return sp.Put(k.Fingerprint, rec.Result)
+	}
+	if err := in.mapRecords(nil, jobs, key, emit); err != nil {
+		mapFailed(err)
+	}
+
+	if !first {
+		for _, g := range index.Groups {
+			if err := sp.Copy(os.Stdout, g.Fingerprint); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	log.Printf("%d records, %d unique", index.Records, len(index.Groups))
+	if groups == "" {
+		return
+	}
+	f, err := os.Create(groups)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, g := range index.Groups {
+		if err := enc.Encode(g); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// spool keeps the latest record put under each fingerprint in a
+// temporary file, remembering only where it is.
+type spool struct {
+	f       *os.File
+	size    int64
+	offsets map[digest.Digest][2]int64
+}
+
+func newSpool() *spool {
+	f, err := ioutil.TempFile("", "dedup")
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Remove(f.Name())
+	return &spool{f: f, offsets: map[digest.Digest][2]int64{}}
+}
+
+// Put writes v as a line of JSON, replacing what was put under fp.
+func (sp *spool) Put(fp digest.Digest, v interface{}) error {
+	dt, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dt = append(dt, '\n')
+	if _, err := sp.f.Write(dt); err != nil {
+		return err
+	}
+	sp.offsets[fp] = [2]int64{sp.size, int64(len(dt))}
+	sp.size += int64(len(dt))
+	return nil
+}
+
+// Copy writes the line put under fp to w.
+func (sp *spool) Copy(w io.Writer, fp digest.Digest) error {
+	at := sp.offsets[fp]
+	_, err := io.Copy(w, io.NewSectionReader(sp.f, at[0], at[1]))
+	return err
+}
+
+func (sp *spool) Close() error {
+	return sp.f.Close()
+}
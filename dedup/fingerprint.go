@@ -0,0 +1,52 @@
+// Package dedup finds Dockerfiles that differ only in layout.
+package dedup
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/btwiuse/buildahfy/format"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/opencontainers/go-digest"
+)
+
+// Fingerprint digests the parse tree of a Dockerfile. Comments, keyword
+// case and continuation style never reach the tree, the case of the
+// HEALTHCHECK type and the AS of FROM is folded as format.Equal does,
+// and runs of blanks are collapsed outside quotes in shell commands, so
+// copies that differ only in those share a fingerprint.
+func Fingerprint(r io.Reader) (digest.Digest, error) {
+	res, err := parser.Parse(r)
+	if err != nil {
+		return "", err
+	}
+	digester := digest.Canonical.Digester()
+	for _, n := range res.AST.Children {
+		writeNode(digester.Hash(), n)
+		fmt.Fprintln(digester.Hash())
+	}
+	return digester.Digest(), nil
+}
+
+// writeNode writes a normalized form of the instruction n and its
+// arguments.
+func writeNode(w io.Writer, n *parser.Node) {
+	json := n.Attributes["json"]
+	cmd := n.Value
+	for i := -1; n != nil; n, i = n.Next, i+1 {
+		value := n.Value
+		if i >= 0 {
+			value = format.Argument(cmd, i, value)
+			if format.Shell(cmd, i, json) {
+				value = format.Squeeze(value)
+			}
+		}
+		fmt.Fprintf(w, "%q %q %t", value, n.Flags, json)
+		for _, child := range n.Children {
+			fmt.Fprint(w, " (")
+			writeNode(w, child)
+			fmt.Fprint(w, ")")
+		}
+		fmt.Fprint(w, ";")
+	}
+}
@@ -0,0 +1,69 @@
+package dedup
+
+import (
+	"strings"
+	"testing"
+)
+
+func fingerprint(t *testing.T, dockerfile string) string {
+	fp, err := Fingerprint(strings.NewReader(dockerfile))
+	if err != nil {
+		t.Fatalf("%q: %v", dockerfile, err)
+	}
+	return string(fp)
+}
+
+func TestFingerprintLayout(t *testing.T) {
+	for _, same := range [][]string{
+		{"FROM x AS b\n", "from x as b\n", "FROM x As b\n"},
+		{"HEALTHCHECK CMD true\n", "HEALTHCHECK cmd true\n", "healthcheck Cmd true\n"},
+		{"ONBUILD HEALTHCHECK CMD true\n", "onbuild healthcheck cmd true\n"},
+		{"RUN a &&    b\n", "RUN a && \\\n    b\n", "# comment\nRUN a && b\n"},
+		{"RUN echo \"x  y\"\n", "RUN   echo   \"x  y\"\n"},
+	} {
+		want := fingerprint(t, same[0])
+		for _, other := range same[1:] {
+			if got := fingerprint(t, other); got != want {
+				t.Errorf("%q and %q have different fingerprints", same[0], other)
+			}
+		}
+	}
+}
+
+func TestFingerprintDistinguishes(t *testing.T) {
+	for _, pair := range [][2]string{
+		{"RUN echo \"x  y\"\n", "RUN echo \"x y\"\n"},
+		{"RUN echo 'x  y'\n", "RUN echo 'x y'\n"},
+		{"RUN echo x\\  y\n", "RUN echo x\\ y\n"},
+		{"FROM x AS b\n", "FROM x AS c\n"},
+		{"CMD [\"a  b\"]\n", "CMD [\"a b\"]\n"},
+		{"LABEL a=b\n", "LABEL A=b\n"},
+		{"WORKDIR /a  b\n", "WORKDIR /a b\n"},
+		{"ENV A x  y\n", "ENV A x y\n"},
+	} {
+		if fingerprint(t, pair[0]) == fingerprint(t, pair[1]) {
+			t.Errorf("%q and %q share a fingerprint", pair[0], pair[1])
+		}
+	}
+}
+
+func TestIndexCanonical(t *testing.T) {
+	x, err := NewIndex(Shortest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range []struct{ id, contents string }{
+		{"long", "FROM x\nRUN a &&    b\n"},
+		{"other", "FROM y\n"},
+		{"short", "from x\nrun a && b\n"},
+	} {
+		x.Add(rec.id, x.Key(rec.contents))
+	}
+	if len(x.Groups) != 2 {
+		t.Fatalf("got %d groups, want 2", len(x.Groups))
+	}
+	g := x.Groups[0]
+	if g.Canonical != "short" || strings.Join(g.Ids, ",") != "long,short" {
+		t.Errorf("group keeps %s of %v, want short of long,short", g.Canonical, g.Ids)
+	}
+}
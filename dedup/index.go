@@ -0,0 +1,101 @@
+package dedup
+
+import (
+	"strings"
+
+	"github.com/btwiuse/buildahfy/format"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// Policy picks the canonical representative of a group of duplicates.
+type Policy string
+
+const (
+	// First keeps the first record seen.
+	First Policy = "first"
+	// Shortest keeps the smallest file.
+	Shortest Policy = "shortest"
+	// Formatted keeps the first file already in the layout of format.Format.
+	Formatted Policy = "formatted"
+)
+
+// Key is what Index needs to know about a record.
+type Key struct {
+	Fingerprint digest.Digest
+	// Parsed is false if the file does not parse, in which case the
+	// fingerprint is the digest of its raw contents.
+	Parsed bool
+	// Rank orders the records of a group for the canonical policy: the
+	// lowest is kept.
+	Rank int
+	// Digest is the digest of the contents as they are.
+	Digest digest.Digest
+}
+
+// Group is a set of records with the same fingerprint.
+type Group struct {
+	Fingerprint digest.Digest `json:"fingerprint"`
+	Parsed      bool          `json:"parsed"`
+	Canonical   string        `json:"canonical"`
+	Ids         []string      `json:"ids"`
+	// Digest is the digest of the contents of the Canonical record.
+	Digest digest.Digest `json:"digest"`
+
+	rank int
+}
+
+// Index groups records by fingerprint, in order of first appearance.
+type Index struct {
+	Records int
+	Groups  []*Group
+
+	policy Policy
+	byKey  map[digest.Digest]*Group
+}
+
+func NewIndex(policy Policy) (*Index, error) {
+	switch policy {
+	case First, Shortest, Formatted:
+	default:
+		return nil, errors.Errorf("unknown policy %q", policy)
+	}
+	return &Index{policy: policy, byKey: map[digest.Digest]*Group{}}, nil
+}
+
+// Key computes the key of a Dockerfile. It is safe to call concurrently.
+func (x *Index) Key(contents string) *Key {
+	d := digest.FromString(contents)
+	fp, err := Fingerprint(strings.NewReader(contents))
+	if err != nil {
+		return &Key{Fingerprint: d, Digest: d}
+	}
+	k := &Key{Fingerprint: fp, Parsed: true, Digest: d}
+	switch x.policy {
+	case Shortest:
+		k.Rank = len(contents)
+	case Formatted:
+		if out, err := format.Format([]byte(contents)); err != nil || string(out) != contents {
+			k.Rank = 1
+		}
+	}
+	return k
+}
+
+// Add files the record with the given Id under its key and reports
+// whether it is now the canonical record of its group.
+func (x *Index) Add(id string, k *Key) bool {
+	x.Records++
+	g, dup := x.byKey[k.Fingerprint]
+	if !dup {
+		g = &Group{Fingerprint: k.Fingerprint, Parsed: k.Parsed}
+		x.byKey[k.Fingerprint] = g
+		x.Groups = append(x.Groups, g)
+	}
+	g.Ids = append(g.Ids, id)
+	if dup && k.Rank >= g.rank {
+		return false
+	}
+	g.Canonical, g.Digest, g.rank = id, k.Digest, k.Rank
+	return true
+}
@@ -0,0 +1,143 @@
+// Package failure classifies why corpus Dockerfiles fail to parse.
+package failure
+
+import (
+	"io"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/moby/buildkit/frontend/dockerfile/shell"
+)
+
+// Category is a stable name for a kind of failure. Reports keyed by it
+// can be compared across runs and parser upgrades.
+type Category string
+
+const (
+	NoInstructions     Category = "no-instructions"
+	LineTooLong        Category = "line-too-long"
+	EscapeDirective    Category = "escape-directive"
+	UnknownInstruction Category = "unknown-instruction"
+	BadFlag            Category = "bad-flag"
+	MissingFrom        Category = "missing-from"
+	InvalidJSONForm    Category = "invalid-json-form"
+	ArgumentCount      Category = "argument-count"
+	BadKeyValue        Category = "bad-key-value"
+	StageName          Category = "stage-name"
+	OnbuildTrigger     Category = "onbuild-trigger"
+	Healthcheck        Category = "healthcheck"
+	RunMount           Category = "run-mount"
+	ShellSyntax        Category = "shell-syntax"
+	Other              Category = "other"
+
+	// EmptyContinuation is only a warning of the parser, reported next
+	// to the failures since it will become an error.
+	EmptyContinuation Category = "empty-continuation"
+)
+
+// patterns maps fragments of the messages of the parser, instructions
+// and shell packages to their category, most specific first.
+var patterns = []struct {
+	fragment string
+	category Category
+}{
+	{"file with no instructions", NoInstructions},
+	{"line greater than max allowed size", LineTooLong},
+	{"invalid ESCAPE", EscapeDirective},
+	{"escape parser directive", EscapeDirective},
+	{"unknown instruction", UnknownInstruction},
+	{"Unknown flag: mount", RunMount},
+	{"Unknown flag", BadFlag},
+	{"Duplicate flag", BadFlag},
+	{"Missing a value on flag", BadFlag},
+	{"Expecting boolean value for flag", BadFlag},
+	{"Arg should start with --", BadFlag},
+	{"No build stage in current context", MissingFrom},
+	{"JSON array", InvalidJSONForm},
+	{"JSON form", InvalidJSONForm},
+	{"invalid name for build stage", StageName},
+	{"ONBUILD", OnbuildTrigger},
+	{"HEALTHCHECK", Healthcheck},
+	{"Interval", Healthcheck},
+	{"--retries", Healthcheck},
+	{"mount", RunMount},
+	{"can't find = in", BadKeyValue},
+	{"must have two arguments", BadKeyValue},
+	{"requires at least", ArgumentCount},
+	{"requires exactly one argument", ArgumentCount},
+	{"requires either one or three arguments", ArgumentCount},
+	{"too many arguments", ArgumentCount},
+	{"names can not be blank", ArgumentCount},
+	{"can not be an empty string", ArgumentCount},
+	{"unexpected end of statement", ShellSyntax},
+	{"syntax error", ShellSyntax},
+	{"substitution", ShellSyntax},
+}
+
+// Classify returns the category of an error from Check.
+func Classify(err error) Category {
+	if instructions.IsUnknownInstruction(err) {
+		return UnknownInstruction
+	}
+	msg := err.Error()
+	for _, p := range patterns {
+		if strings.Contains(msg, p.fragment) {
+			return p.category
+		}
+	}
+	return Other
+}
+
+// Result is the outcome of Check in a form that can be stored, with the
+// error kept as its category and message.
+type Result struct {
+	Warnings []Category `json:"warnings"`
+	Category Category   `json:"category,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+func NewResult(warnings []Category, err error) *Result {
+	res := &Result{Warnings: warnings}
+	if err != nil {
+		res.Category, res.Error = Classify(err), err.Error()
+	}
+	return res
+}
+
+// Check parses a Dockerfile the way a build would: the parser, then the
+// instructions, then word expansion with the shell lexer. It returns the
+// categories of the parser warnings and the first error.
+func Check(r io.Reader) ([]Category, error) {
+	res, err := parser.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	warnings := []Category{}
+	for _, w := range res.Warnings {
+		if strings.Contains(w, "Empty continuation line found") {
+			warnings = append(warnings, EmptyContinuation)
+		}
+	}
+	stages, _, err := instructions.Parse(res.AST)
+	if err != nil {
+		return warnings, err
+	}
+	lex := shell.NewLex(res.EscapeToken)
+	expand := func(word string) (string, error) {
+		return lex.ProcessWord(word, []string{})
+	}
+	for _, stage := range stages {
+		if _, err := expand(stage.BaseName); err != nil {
+			return warnings, err
+		}
+		for _, cmd := range stage.Commands {
+			if e, ok := cmd.(instructions.SupportsSingleWordExpansion); ok {
+				if err := e.Expand(expand); err != nil {
+					return warnings, err
+				}
+			}
+		}
+	}
+	return warnings, nil
+}
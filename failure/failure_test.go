@@ -0,0 +1,77 @@
+package failure
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	for _, tc := range []struct {
+		dt       string
+		category Category
+	}{
+		{"", NoInstructions},
+		{"# escape=x\nFROM a\n", EscapeDirective},
+		{"FROM a\nFOO bar\n", UnknownInstruction},
+		{"FROM a\nCOPY --bogus=1 a b\n", BadFlag},
+		{"FROM a\nRUN --mount=type=cache make\n", RunMount},
+		{"RUN make\nFROM a\n", MissingFrom},
+		{"FROM a\nEXPOSE\n", ArgumentCount},
+		{"FROM a\nLABEL a\n", BadKeyValue},
+		{"FROM a AS 1st\n", StageName},
+		{"FROM a\nONBUILD FROM b\n", OnbuildTrigger},
+		{"FROM ${a\n", ShellSyntax},
+		{"FROM a\nWORKDIR ${x:?}\n", ShellSyntax},
+		{"FROM a\nRUN make\n", ""},
+	} {
+		_, err := Check(strings.NewReader(tc.dt))
+		got := Category("")
+		if err != nil {
+			got = Classify(err)
+		}
+		if got != tc.category {
+			t.Errorf("%q: %q (%v), want %q", tc.dt, got, err, tc.category)
+		}
+	}
+}
+
+func TestCheckWarnings(t *testing.T) {
+	warnings, err := Check(strings.NewReader("FROM a\nRUN make \\\n\n  install\nFOO\n"))
+	if !reflect.DeepEqual(warnings, []Category{EmptyContinuation}) || Classify(err) != UnknownInstruction {
+		t.Errorf("got %v and %v, want the warning alongside the error", warnings, err)
+	}
+	if Classify(errors.New("something else")) != Other {
+		t.Error("an unknown message is not Other")
+	}
+}
+
+func TestReport(t *testing.T) {
+	r := NewReport(2)
+	for _, id := range []string{"a", "b", "c"} {
+		r.Add(id, nil, errors.New("unknown instruction: FOO"))
+	}
+	r.Add("d", []Category{EmptyContinuation}, nil)
+	r.AddResult("e", &Result{Category: MissingFrom, Error: "No build stage in current context"})
+
+	if r.Records != 5 || r.Failed != 4 {
+		t.Errorf("%d records, %d failed, want 5 and 4", r.Records, r.Failed)
+	}
+	e := r.Categories[UnknownInstruction]
+	if e.Count != 3 || !reflect.DeepEqual(e.Samples, []string{"a", "b"}) || e.Message != "unknown instruction: FOO" {
+		t.Errorf("unknown instruction entry %+v", e)
+	}
+	if want := []Category{UnknownInstruction, EmptyContinuation, MissingFrom}; !reflect.DeepEqual(r.sorted(), want) {
+		t.Errorf("sorted %v, want %v", r.sorted(), want)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := r.WriteCSV(buf); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 4 || lines[1] != "unknown-instruction,3,a b,unknown instruction: FOO" {
+		t.Errorf("CSV:\n%s", buf)
+	}
+}
@@ -0,0 +1,107 @@
+package failure
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Report counts failures per category over a corpus and keeps the Ids of
+// a few samples of each.
+type Report struct {
+	Records    int                 `json:"records"`
+	Failed     int                 `json:"failed"`
+	Categories map[Category]*Entry `json:"categories"`
+
+	samples int
+}
+
+type Entry struct {
+	Count   int      `json:"count"`
+	Samples []string `json:"samples"`
+	// Message is the error of the first sample.
+	Message string `json:"message,omitempty"`
+}
+
+// NewReport returns a report keeping up to samples Ids per category.
+func NewReport(samples int) *Report {
+	return &Report{Categories: map[Category]*Entry{}, samples: samples}
+}
+
+// Add records the outcome of Check for one record.
+func (r *Report) Add(id string, warnings []Category, err error) {
+	r.AddResult(id, NewResult(warnings, err))
+}
+
+// AddResult records the outcome of Check for one record as a Result.
+func (r *Report) AddResult(id string, res *Result) {
+	r.Records++
+	for _, w := range res.Warnings {
+		r.add(id, w, "")
+	}
+	if res.Error != "" {
+		r.Failed++
+		r.add(id, res.Category, res.Error)
+	}
+}
+
+func (r *Report) add(id string, c Category, msg string) {
+	e, ok := r.Categories[c]
+	if !ok {
+		e = &Entry{Samples: []string{}, Message: msg}
+		r.Categories[c] = e
+	}
+	e.Count++
+	if len(e.Samples) < r.samples {
+		e.Samples = append(e.Samples, id)
+	}
+}
+
+// sorted lists the categories by descending count.
+func (r *Report) sorted() []Category {
+	cats := []Category{}
+	for c := range r.Categories {
+		cats = append(cats, c)
+	}
+	sort.Slice(cats, func(i, j int) bool {
+		ci, cj := r.Categories[cats[i]], r.Categories[cats[j]]
+		if ci.Count != cj.Count {
+			return ci.Count > cj.Count
+		}
+		return cats[i] < cats[j]
+	})
+	return cats
+}
+
+func (r *Report) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "%d records, %d failed\n", r.Records, r.Failed)
+	for _, c := range r.sorted() {
+		e := r.Categories[c]
+		fmt.Fprintf(w, "%8d  %-20s %s\n", e.Count, c, strings.Join(e.Samples, " "))
+		if e.Message != "" {
+			fmt.Fprintf(w, "%8s  %-20s e.g. %s\n", "", "", e.Message)
+		}
+	}
+	return nil
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"category", "count", "samples", "message"})
+	for _, c := range r.sorted() {
+		e := r.Categories[c]
+		cw.Write([]string{string(c), strconv.Itoa(e.Count), strings.Join(e.Samples, " "), e.Message})
+	}
+	cw.Flush()
+	return cw.Error()
+}
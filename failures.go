@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/corpus"
+	"github.com/btwiuse/buildahfy/failure"
+)
+
+// failuresMain classifies the parse failures of the corpus and reports
+// the count and sample Ids of each category.
+func failuresMain(args []string) {
+	format, samples, jobs := "", 0, 0
+	fs := flag.NewFlagSet("failures", flag.ExitOnError)
+	fs.StringVar(&format, "format", "text", "output format: text, json or csv")
+	fs.IntVar(&samples, "samples", 5, "number of sample Ids to keep per category")
+	fs.IntVar(&jobs, "j", runtime.NumCPU(), "number of records to process in parallel")
+	path := addStoreFlag(fs)
+	in := addInputFlags(fs)
+	fs.Parse(args)
+	checkFormat(format, "text", "json", "csv")
+
+	st := openStore(*path)
+	defer st.Close()
+	report := failure.NewReport(samples)
+	check := func(rec *corpus.Record) interface{} {
+		res := &failure.Result{}
+		loadStored(st, bucket("failures"), rec, res, func() error {
+			*res = *failure.NewResult(failure.Check(strings.NewReader(rec.Contents)))
+			return nil
+		})
+		return res
+	}
+	emit := func(rec *corpus.Record, res interface{}) error {
+		report.AddResult(rec.Id, res.(*failure.Result))
+		return nil
+	}
+	if err := in.mapRecords(nil, jobs, check, emit); err != nil {
+		mapFailed(err)
+	}
+
+	var err error
+	switch format {
+	case "text":
+		err = report.WriteText(os.Stdout)
+	case "json":
+		err = report.WriteJSON(os.Stdout)
+	case "csv":
+		err = report.WriteCSV(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
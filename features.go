@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/corpus"
+	"github.com/btwiuse/buildahfy/features"
+)
+
+// featuresMain reports the features each Dockerfile of the corpus uses
+// and the oldest Docker, BuildKit and buildah releases that build it.
+func featuresMain(args []string) {
+	format, jobs := "", 0
+	fs := flag.NewFlagSet("features", flag.ExitOnError)
+	fs.StringVar(&format, "format", "text", "output format: text or json for a summary, or ndjson for one object per record")
+	fs.IntVar(&jobs, "j", runtime.NumCPU(), "number of records to process in parallel")
+	path := addStoreFlag(fs)
+	in := addInputFlags(fs)
+	fs.Parse(args)
+	checkFormat(format, "text", "json", "ndjson")
+
+	type record struct {
+		Id string `json:"id"`
+		*features.File
+		Error string `json:"error,omitempty"`
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	rep := features.NewReport()
+	st := openStore(*path)
+	defer st.Close()
+	detect := func(rec *corpus.Record) interface{} {
+		r := &record{}
+		loadStored(st, bucket("features"), rec, r, func() error {
+			f, err := features.Detect(strings.NewReader(rec.Contents))
+			if err != nil {
+				r.Error = err.Error()
+			}
+			r.File = f
+			return nil
+		})
+		r.Id = rec.Id
+		return r
+	}
+	emit := func(rec *corpus.Record, res interface{}) error {
+		r := res.(*record)
+		if format == "ndjson" {
+			return enc.Encode(r)
+		}
+		rep.Add(r.File)
+		return nil
+	}
+	if err := in.mapRecords(nil, jobs, detect, emit); err != nil {
+		mapFailed(err)
+	}
+
+	var err error
+	switch format {
+	case "text":
+		err = rep.WriteText(os.Stdout)
+	case "json":
+		err = rep.WriteJSON(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,303 @@
+// Package features finds the Dockerfile syntax and features a file
+// relies on, and from them the oldest Docker, BuildKit and buildah
+// releases that can build it.
+package features
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/llbdump"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/util/apicaps"
+)
+
+// Feature is something a Dockerfile may use, with the first releases
+// able to build it.
+type Feature struct {
+	Name   string
+	Docker string
+	// DockerBuildKit is set when Docker builds the feature only with
+	// BuildKit enabled, which it is by default from 23.0.
+	DockerBuildKit bool
+	BuildKit       string
+	// Buildah is "" when buildah cannot build the feature at all.
+	Buildah string
+	// Caps are LLB capabilities the feature requests, for when the
+	// vendored dockerfile2llb cannot convert it to find out.
+	Caps []apicaps.CapID
+}
+
+// Features lists what Detect looks for. The releases are those that
+// first shipped each feature without an experimental syntax directive.
+var Features = []Feature{
+	{Name: "LABEL", Docker: "1.6", BuildKit: "0.1", Buildah: "1.0"},
+	{Name: "ARG", Docker: "1.9", BuildKit: "0.1", Buildah: "1.0"},
+	{Name: "STOPSIGNAL", Docker: "1.9", BuildKit: "0.1", Buildah: "1.0"},
+	{Name: "HEALTHCHECK", Docker: "1.12", BuildKit: "0.1", Buildah: "1.0"},
+	{Name: "SHELL", Docker: "1.12", BuildKit: "0.1", Buildah: "1.0"},
+	{Name: "multi-stage", Docker: "17.05", BuildKit: "0.1", Buildah: "1.0"},
+	{Name: "ARG before FROM", Docker: "17.05", BuildKit: "0.1", Buildah: "1.0"},
+	{Name: "COPY --from", Docker: "17.05", BuildKit: "0.1", Buildah: "1.0"},
+	{Name: "COPY --chown", Docker: "17.09", BuildKit: "0.1", Buildah: "1.0"},
+	{Name: "ADD --chown", Docker: "17.09", BuildKit: "0.1", Buildah: "1.0"},
+	{Name: "FROM --platform", Docker: "18.09", DockerBuildKit: true, BuildKit: "0.3", Buildah: "1.11"},
+	{Name: "syntax directive", Docker: "18.09", DockerBuildKit: true, BuildKit: "0.3", Buildah: "1.0"},
+	{Name: "RUN --mount=type=bind", Docker: "20.10", DockerBuildKit: true, BuildKit: "0.8", Buildah: "1.19", Caps: []apicaps.CapID{pb.CapExecMountBind, pb.CapExecMountSelector}},
+	{Name: "RUN --mount=type=cache", Docker: "20.10", DockerBuildKit: true, BuildKit: "0.8", Buildah: "1.19", Caps: []apicaps.CapID{pb.CapExecMountCache, pb.CapExecMountCacheSharing}},
+	{Name: "RUN --mount=type=tmpfs", Docker: "20.10", DockerBuildKit: true, BuildKit: "0.8", Buildah: "1.19", Caps: []apicaps.CapID{pb.CapExecMountTmpfs}},
+	{Name: "RUN --mount=type=secret", Docker: "20.10", DockerBuildKit: true, BuildKit: "0.8", Buildah: "1.23", Caps: []apicaps.CapID{pb.CapExecMountSecret}},
+	{Name: "RUN --mount=type=ssh", Docker: "20.10", DockerBuildKit: true, BuildKit: "0.8", Buildah: "1.23", Caps: []apicaps.CapID{pb.CapExecMountSSH}},
+	{Name: "RUN --network", Docker: "20.10", DockerBuildKit: true, BuildKit: "0.9", Buildah: "1.22", Caps: []apicaps.CapID{pb.CapExecMetaNetwork}},
+	{Name: "RUN --security", Docker: "20.10", DockerBuildKit: true, BuildKit: "0.9", Buildah: "", Caps: []apicaps.CapID{pb.CapExecMetaSecurity}},
+	{Name: "COPY --chmod", Docker: "20.10", DockerBuildKit: true, BuildKit: "0.9", Buildah: "1.23"},
+	{Name: "ADD --chmod", Docker: "20.10", DockerBuildKit: true, BuildKit: "0.9", Buildah: "1.23"},
+	{Name: "COPY --link", Docker: "23.0", DockerBuildKit: true, BuildKit: "0.10", Buildah: "1.31"},
+	{Name: "ADD --link", Docker: "23.0", DockerBuildKit: true, BuildKit: "0.10", Buildah: "1.31"},
+	{Name: "heredoc", Docker: "23.0", DockerBuildKit: true, BuildKit: "0.10", Buildah: "1.33"},
+}
+
+var byName = map[string]Feature{}
+
+func init() {
+	for _, f := range Features {
+		byName[f.Name] = f
+	}
+}
+
+var (
+	syntaxDirective = regexp.MustCompile(`(?i)^#\s*syntax\s*=\s*(\S+)`)
+	// heredoc matches the start of a here-document on RUN, COPY or ADD,
+	// such as RUN <<EOF or COPY <<-"EOT" /dst.
+	heredoc = regexp.MustCompile(`(?i)^\s*(run|copy|add)\b.*<<-?\s*["']?[A-Za-z_][A-Za-z0-9_]*["']?`)
+)
+
+// File is what a Dockerfile relies on.
+type File struct {
+	Features []string `json:"features"`
+	// Syntax is the frontend image named by a syntax directive.
+	Syntax         string `json:"syntax,omitempty"`
+	Docker         string `json:"docker"`
+	DockerBuildKit bool   `json:"docker_buildkit"`
+	BuildKit       string `json:"buildkit"`
+	// Buildah is "" when buildah cannot build the file.
+	Buildah string `json:"buildah"`
+	// Caps are the LLB capabilities the build requests. They are missing
+	// when the vendored dockerfile2llb cannot convert the file, which
+	// LLBError then explains.
+	Caps     []string `json:"caps"`
+	LLBError string   `json:"llb_error,omitempty"`
+}
+
+// Detect reads a Dockerfile and finds the features it uses.
+func Detect(r io.Reader) (*File, error) {
+	dt, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	res, err := parser.Parse(bytes.NewReader(dt))
+	f, err := Uses(dt, res, err)
+	if err != nil {
+		return nil, err
+	}
+	f.caps(dt)
+	return f, nil
+}
+
+// Uses finds the features of dt, which res and err are the result of
+// parsing, without the LLB capabilities Detect converts the file for.
+func Uses(dt []byte, res *parser.Result, err error) (*File, error) {
+	f := &File{Features: []string{}, Caps: []string{}}
+	seen := map[string]bool{}
+	use := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			f.Features = append(f.Features, name)
+		}
+	}
+
+	directives := true
+	sc := bufio.NewScanner(bytes.NewReader(dt))
+	sc.Buffer(nil, len(dt)+1)
+	for sc.Scan() {
+		line := sc.Text()
+		if m := syntaxDirective.FindStringSubmatch(line); directives && m != nil {
+			f.Syntax = m[1]
+			use("syntax directive")
+		}
+		if !strings.HasPrefix(line, "#") {
+			directives = false
+		}
+		if heredoc.MatchString(line) {
+			use("heredoc")
+		}
+	}
+
+	// the vendored parser predates heredocs and may fail on them, in
+	// which case the lines above are all there is to go by
+	if err != nil {
+		if !seen["heredoc"] {
+			return nil, err
+		}
+		f.require()
+		return f, nil
+	}
+	froms := 0
+	for _, n := range res.AST.Children {
+		name := strings.ToUpper(n.Value)
+		switch name {
+		case "LABEL", "ARG", "STOPSIGNAL", "HEALTHCHECK", "SHELL":
+			use(name)
+		}
+		if name == "ARG" && froms == 0 {
+			use("ARG before FROM")
+		}
+		if name == "FROM" {
+			froms++
+			if froms == 2 {
+				use("multi-stage")
+			}
+		}
+		flags(name, n.Flags, use)
+		// the flags of a trigger count as if the file used them
+		if name == "ONBUILD" && n.Next != nil && len(n.Next.Children) > 0 {
+			trigger := n.Next.Children[0]
+			flags(strings.ToUpper(trigger.Value), trigger.Flags, use)
+		}
+	}
+	sort.Slice(f.Features, func(i, j int) bool {
+		return index(f.Features[i]) < index(f.Features[j])
+	})
+	f.require()
+	return f, nil
+}
+
+// caps sets the LLB capabilities the build of dt requests: those of the
+// converted ops, and those known to come with the features used.
+func (f *File) caps(dt []byte) {
+	caps := map[string]bool{}
+	add := func(c apicaps.CapID) {
+		if !caps[string(c)] {
+			caps[string(c)] = true
+			f.Caps = append(f.Caps, string(c))
+		}
+	}
+	defer func() { sort.Strings(f.Caps) }()
+	for _, name := range f.Features {
+		for _, c := range byName[name].Caps {
+			add(c)
+		}
+	}
+	def, err := llbdump.Convert(dt, llbdump.Options{})
+	if err != nil {
+		f.LLBError = err.Error()
+		return
+	}
+	ops, err := llbdump.Ops(def)
+	if err != nil {
+		f.LLBError = err.Error()
+		return
+	}
+	for _, op := range ops {
+		for c, on := range op.OpMetadata.Caps {
+			if on {
+				add(c)
+			}
+		}
+	}
+}
+
+// flags uses the features of the flags of the instruction name.
+func flags(name string, flags []string, use func(string)) {
+	for _, flag := range flags {
+		key, value := flag, ""
+		if i := strings.Index(flag, "="); i >= 0 {
+			key, value = flag[:i], flag[i+1:]
+		}
+		if name == "RUN" && key == "--mount" {
+			use("RUN --mount=type=" + mountType(value))
+			continue
+		}
+		if _, ok := byName[name+" "+key]; ok {
+			use(name + " " + key)
+		}
+	}
+}
+
+// mountType returns the type of a --mount value, bind by default.
+func mountType(value string) string {
+	for _, field := range strings.Split(value, ",") {
+		if strings.HasPrefix(field, "type=") {
+			return strings.TrimPrefix(field, "type=")
+		}
+	}
+	return "bind"
+}
+
+func index(name string) int {
+	for i, f := range Features {
+		if f.Name == name {
+			return i
+		}
+	}
+	return len(Features)
+}
+
+// require sets the releases the file needs to the newest its features
+// need. A mount type Features does not know needs at least what a bind
+// mount does, and counts as one buildah cannot build.
+func (f *File) require() {
+	f.Docker, f.BuildKit, f.Buildah = "1.0", "0.1", "1.0"
+	for _, name := range f.Features {
+		feat, ok := byName[name]
+		if !ok {
+			feat = byName["RUN --mount=type=bind"]
+			feat.Buildah = ""
+		}
+		f.Docker = Newer(f.Docker, feat.Docker)
+		f.BuildKit = Newer(f.BuildKit, feat.BuildKit)
+		f.DockerBuildKit = f.DockerBuildKit || feat.DockerBuildKit
+		if feat.Buildah == "" || f.Buildah == "" {
+			f.Buildah = ""
+			continue
+		}
+		f.Buildah = Newer(f.Buildah, feat.Buildah)
+	}
+}
+
+// Newer returns the newer of two dotted release numbers.
+func Newer(a, b string) string {
+	if Compare(a, b) < 0 {
+		return b
+	}
+	return a
+}
+
+// Compare compares dotted release numbers such as 1.12 and 17.05 part by
+// part, returning -1, 0 or 1.
+func Compare(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,111 @@
+package features
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func detect(t *testing.T, dockerfile string) *File {
+	f, err := Detect(strings.NewReader(dockerfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestDetect(t *testing.T) {
+	for _, tc := range []struct {
+		name, dockerfile string
+		features         string
+		docker, buildkit string
+		dockerBuildKit   bool
+		buildah          string
+	}{
+		{
+			"plain", "FROM alpine\nRUN true\n",
+			"", "1.0", "0.1", false, "1.0",
+		},
+		{
+			"multi-stage", "ARG V=1\nFROM alpine AS a\nHEALTHCHECK NONE\nFROM alpine\nCOPY --from=a --chown=1 / /\n",
+			"ARG,HEALTHCHECK,multi-stage,ARG before FROM,COPY --from,COPY --chown", "17.09", "0.1", false, "1.0",
+		},
+		{
+			"cache mount", "# syntax=docker/dockerfile:1\nFROM alpine\nRUN --mount=type=cache,target=/c true\n",
+			"syntax directive,RUN --mount=type=cache", "20.10", "0.8", true, "1.19",
+		},
+		{
+			"security", "FROM alpine\nRUN --security=insecure true\n",
+			"RUN --security", "20.10", "0.9", true, "",
+		},
+		{
+			"heredoc", "FROM alpine\nRUN <<EOF\necho hi\nEOF\n",
+			"heredoc", "23.0", "0.10", true, "1.33",
+		},
+		{
+			"unknown mount", "FROM alpine\nRUN --mount=type=magic true\n",
+			"RUN --mount=type=magic", "20.10", "0.8", true, "",
+		},
+		{
+			"onbuild mount", "FROM alpine\nONBUILD RUN --mount=type=ssh true\n",
+			"RUN --mount=type=ssh", "20.10", "0.8", true, "1.23",
+		},
+	} {
+		f := detect(t, tc.dockerfile)
+		if got := strings.Join(f.Features, ","); got != tc.features {
+			t.Errorf("%s: features %q, want %q", tc.name, got, tc.features)
+		}
+		if f.Docker != tc.docker || f.BuildKit != tc.buildkit || f.DockerBuildKit != tc.dockerBuildKit || f.Buildah != tc.buildah {
+			t.Errorf("%s: releases docker %s buildkit %v %s buildah %q", tc.name, f.Docker, f.DockerBuildKit, f.BuildKit, f.Buildah)
+		}
+	}
+}
+
+func TestDetectCaps(t *testing.T) {
+	f := detect(t, "FROM alpine\nRUN --mount=type=cache,target=/c true\n")
+	caps := strings.Join(f.Caps, " ")
+	// the vendored dockerfile2llb converts mounts only with the
+	// dfrunmount tag; either way the caps of the feature are there
+	if !strings.Contains(caps, "exec.mount.cache") {
+		t.Errorf("caps %q lack the cache mount", caps)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.12", "1.9", 1},
+		{"17.05", "17.5", 0},
+		{"0.10", "0.9", 1},
+		{"20.10", "23.0", -1},
+		{"1", "1.0", 0},
+	} {
+		if got := Compare(tc.a, tc.b); got != tc.want {
+			t.Errorf("Compare(%s, %s) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+	if Newer("1.9", "1.12") != "1.12" {
+		t.Error("Newer picked the older release")
+	}
+}
+
+func TestReport(t *testing.T) {
+	rep := NewReport()
+	rep.Add(detect(t, "FROM alpine\n"))
+	rep.Add(detect(t, "FROM alpine\nRUN --security=insecure true\n"))
+	rep.Add(nil)
+	if rep.Files != 3 || rep.Failed != 1 {
+		t.Errorf("files %d failed %d", rep.Files, rep.Failed)
+	}
+	if rep.Docker["1.0"] != 1 || rep.Docker["20.10+buildkit"] != 1 || rep.Buildah["unsupported"] != 1 {
+		t.Errorf("docker %v buildah %v", rep.Docker, rep.Buildah)
+	}
+	buf := &bytes.Buffer{}
+	rep.WriteText(buf)
+	// the file buildah cannot build is not among those it can
+	if !strings.Contains(buf.String(), "\nunsupported                         1          -\n") {
+		t.Errorf("buildah releases in\n%s", buf)
+	}
+}
@@ -0,0 +1,141 @@
+package features
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Report aggregates the requirements of a corpus.
+type Report struct {
+	Files  int `json:"files"`
+	Failed int `json:"failed"`
+	// Features counts files by feature used.
+	Features map[string]int `json:"features"`
+	// Docker, BuildKit and Buildah count files by the oldest release
+	// that builds them. Docker releases that need BuildKit enabled end
+	// in "+buildkit", and files buildah cannot build count under
+	// "unsupported".
+	Docker   map[string]int `json:"docker"`
+	BuildKit map[string]int `json:"buildkit"`
+	Buildah  map[string]int `json:"buildah"`
+	// Caps counts files by the LLB capabilities they request.
+	Caps      map[string]int `json:"caps"`
+	LLBErrors int            `json:"llb_errors"`
+}
+
+func NewReport() *Report {
+	return &Report{
+		Features: map[string]int{},
+		Docker:   map[string]int{},
+		BuildKit: map[string]int{},
+		Buildah:  map[string]int{},
+		Caps:     map[string]int{},
+	}
+}
+
+// Add counts one file; a nil file counts as one that failed to parse.
+func (rep *Report) Add(f *File) {
+	rep.Files++
+	if f == nil {
+		rep.Failed++
+		return
+	}
+	for _, name := range f.Features {
+		rep.Features[name]++
+	}
+	docker := f.Docker
+	if f.DockerBuildKit {
+		docker += "+buildkit"
+	}
+	rep.Docker[docker]++
+	rep.BuildKit[f.BuildKit]++
+	if f.Buildah == "" {
+		rep.Buildah["unsupported"]++
+	} else {
+		rep.Buildah[f.Buildah]++
+	}
+	for _, c := range f.Caps {
+		rep.Caps[c]++
+	}
+	if f.LLBError != "" {
+		rep.LLBErrors++
+	}
+}
+
+func (rep *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rep)
+}
+
+func (rep *Report) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "%d files, %d failed to parse, %d not converted to LLB\n\n", rep.Files, rep.Failed, rep.LLBErrors)
+	fmt.Fprintf(w, "%-26s %8s %8s %8s %10s\n", "feature", "docker", "buildkit", "buildah", "files")
+	for _, f := range Features {
+		if rep.Features[f.Name] == 0 {
+			continue
+		}
+		docker, buildah := f.Docker, f.Buildah
+		if f.DockerBuildKit {
+			docker += "+bk"
+		}
+		if buildah == "" {
+			buildah = "-"
+		}
+		fmt.Fprintf(w, "%-26s %8s %8s %8s %10d\n", f.Name, docker, f.BuildKit, buildah, rep.Features[f.Name])
+	}
+	for _, engine := range []struct {
+		name   string
+		counts map[string]int
+	}{{"docker", rep.Docker}, {"buildkit", rep.BuildKit}, {"buildah", rep.Buildah}} {
+		fmt.Fprintf(w, "\n%-26s %10s %10s\n", engine.name+" release", "files", "buildable")
+		buildable := 0
+		for _, release := range releases(engine.counts) {
+			if release == "unsupported" {
+				fmt.Fprintf(w, "%-26s %10d %10s\n", release, engine.counts[release], "-")
+				continue
+			}
+			buildable += engine.counts[release]
+			fmt.Fprintf(w, "%-26s %10d %10d\n", release, engine.counts[release], buildable)
+		}
+	}
+	fmt.Fprintf(w, "\n%-40s %10s\n", "llb capability", "files")
+	caps := []string{}
+	for c := range rep.Caps {
+		caps = append(caps, c)
+	}
+	sort.Strings(caps)
+	for _, c := range caps {
+		fmt.Fprintf(w, "%-40s %10d\n", c, rep.Caps[c])
+	}
+	return nil
+}
+
+// releases sorts the keys of counts oldest first, with Docker releases
+// needing BuildKit after the plain one and "unsupported" last.
+func releases(counts map[string]int) []string {
+	keys := []string{}
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a == "unsupported" || b == "unsupported" {
+			return b == "unsupported" && a != b
+		}
+		if c := Compare(trimBuildKit(a), trimBuildKit(b)); c != 0 {
+			return c < 0
+		}
+		return a < b
+	})
+	return keys
+}
+
+func trimBuildKit(release string) string {
+	if len(release) > 9 && release[len(release)-9:] == "+buildkit" {
+		return release[:len(release)-9]
+	}
+	return release
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/btwiuse/buildahfy/format"
+)
+
+// fmtMain rewrites Dockerfiles canonically. With no files it formats
+// stdin to stdout.
+func fmtMain(args []string) {
+	check, write := false, false
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	fs.BoolVar(&check, "check", false, "list files that are not formatted and exit 1 if any")
+	fs.BoolVar(&write, "w", false, "write the result back to the files")
+	fs.Parse(args)
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	unformatted := 0
+	for _, file := range files {
+		src, err := readFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		out, err := format.Format(src)
+		if err != nil {
+			log.Fatal(file, ": ", err)
+		}
+		switch {
+		case check:
+			if !bytes.Equal(src, out) {
+				fmt.Println(file)
+				unformatted++
+			}
+		case write && file != "-":
+			if !bytes.Equal(src, out) {
+				if err := ioutil.WriteFile(file, out, 0644); err != nil {
+					log.Fatal(err)
+				}
+			}
+		default:
+			os.Stdout.Write(out)
+		}
+	}
+	if unformatted > 0 {
+		os.Exit(1)
+	}
+}
+
+func readFile(file string) ([]byte, error) {
+	if file == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(file)
+}
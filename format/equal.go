@@ -0,0 +1,76 @@
+package format
+
+import (
+	"github.com/moby/buildkit/frontend/dockerfile/command"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// Equal reports whether two parse trees describe the same instructions.
+// Original text and line numbers are ignored, and so is the json
+// attribute of ADD, COPY and VOLUME, which the instructions package
+// never reads. The HEALTHCHECK type and the AS of FROM are compared
+// without case, as the instructions package reads them.
+func Equal(a, b *parser.Node) bool {
+	return equal(a, b, "", 0)
+}
+
+// equal compares a and b, the i-th arguments of the instruction cmd, or
+// instructions themselves when cmd is empty.
+func equal(a, b *parser.Node, cmd string, i int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if !equalValues(cmd, i, a.Value, b.Value) || !equalStrings(a.Flags, b.Flags) || len(a.Children) != len(b.Children) {
+		return false
+	}
+	if !equalAttributes(a.Value, a.Attributes, b.Attributes) {
+		return false
+	}
+	for i := range a.Children {
+		if !Equal(a.Children[i], b.Children[i]) {
+			return false
+		}
+	}
+	if cmd == "" {
+		return equal(a.Next, b.Next, a.Value, 0)
+	}
+	return equal(a.Next, b.Next, cmd, i+1)
+}
+
+func equalValues(cmd string, i int, a, b string) bool {
+	return Argument(cmd, i, a) == Argument(cmd, i, b)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalAttributes(cmd string, a, b map[string]bool) bool {
+	for _, attrs := range [][2]map[string]bool{{a, b}, {b, a}} {
+		for k, v := range attrs[0] {
+			if k == "json" && formNeutral[cmd] {
+				continue
+			}
+			if attrs[1][k] != v {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// formNeutral lists the instructions whose exec and shell forms parse to
+// the same argument list.
+var formNeutral = map[string]bool{
+	command.Add:    true,
+	command.Copy:   true,
+	command.Volume: true,
+}
@@ -0,0 +1,313 @@
+// Package format rewrites Dockerfiles into a canonical layout.
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/command"
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/pkg/errors"
+)
+
+const indent = "    "
+
+var utf8bom = []byte{0xEF, 0xBB, 0xBF}
+
+var (
+	tokenWhitespace = regexp.MustCompile(`[\t\v\f\r ]+`)
+	tokenComment    = regexp.MustCompile(`^[\t\v\f\r ]*#`)
+	// plainWord matches list elements that read the same unquoted.
+	plainWord = regexp.MustCompile("^[^\\s\"'\\\\`$\\[\\]#]+$")
+)
+
+// Format parses src and returns it in canonical form: instruction
+// keywords are uppercased, continuation lines end in a single space and
+// the escape token and are indented by four spaces, JSON arrays are
+// spaced consistently, ADD, COPY and VOLUME use the plain form when no
+// quoting is needed, and runs of blank lines are collapsed. Comments and
+// parser directives are kept in place. An instruction the instructions
+// package rejects, for example as unknown, is an error.
+//
+// Every rewritten instruction must parse back to the same tree (see
+// Equal); where the canonical layout would change it, the original
+// lines are kept with only the keyword rewritten. In particular the
+// continuation lines of a shell-form command keep the indentation the
+// author gave them, as it is part of the command.
+func Format(src []byte) ([]byte, error) {
+	res, err := parser.Parse(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range res.AST.Children {
+		if _, err := instructions.ParseInstruction(n); err != nil {
+			return nil, errors.Wrapf(err, "line %d", n.StartLine)
+		}
+	}
+	f := &formatter{
+		lines:        splitLines(src),
+		escape:       string(res.EscapeToken),
+		continuation: regexp.MustCompile(regexp.QuoteMeta(string(res.EscapeToken)) + `[ \t]*$`),
+	}
+	out := []string{}
+	next := 1
+	for _, n := range res.AST.Children {
+		out = append(out, f.between(next, n.StartLine)...)
+		out = append(out, f.instruction(n)...)
+		next = n.EndLine + 1
+	}
+	out = append(out, f.between(next, len(f.lines)+1)...)
+	formatted := []byte(strings.Join(collapseBlanks(out), "\n") + "\n")
+
+	check, err := parser.Parse(bytes.NewReader(formatted))
+	if err != nil {
+		return nil, errors.Wrap(err, "formatted Dockerfile does not parse")
+	}
+	if check.EscapeToken != res.EscapeToken || len(check.AST.Children) != len(res.AST.Children) {
+		return nil, errors.New("formatting changed the instructions")
+	}
+	for i, n := range res.AST.Children {
+		if !Equal(n, check.AST.Children[i]) {
+			return nil, errors.Errorf("formatting changed line %d", n.StartLine)
+		}
+	}
+	return formatted, nil
+}
+
+type formatter struct {
+	lines        []string
+	escape       string
+	continuation *regexp.Regexp
+}
+
+// between returns the comments and blank lines in [start, end).
+func (f *formatter) between(start, end int) []string {
+	out := []string{}
+	for i := start; i < end && i <= len(f.lines); i++ {
+		out = append(out, strings.TrimSpace(f.lines[i-1]))
+	}
+	return out
+}
+
+// instruction returns the lines for n, preferring the canonical layout
+// and falling back to progressively closer copies of the original.
+func (f *formatter) instruction(n *parser.Node) []string {
+	for _, candidate := range [][]string{f.canonical(n, true), f.canonical(n, false), f.conservative(n)} {
+		if candidate != nil && f.reparses(candidate, n) {
+			return candidate
+		}
+	}
+	return f.lines[n.StartLine-1 : n.EndLine]
+}
+
+// canonical lays n out canonically. With squeeze set, runs of
+// whitespace inside the arguments are collapsed as well.
+func (f *formatter) canonical(n *parser.Node, squeeze bool) []string {
+	if n.Attributes["json"] {
+		return append(f.comments(n), f.singleLine(n)...)
+	}
+	tidy := func(s string) string {
+		if squeeze {
+			return tokenWhitespace.ReplaceAllString(s, " ")
+		}
+		return s
+	}
+	lines := f.relayout(n, func(s string) string {
+		return indent + tidy(strings.TrimSpace(s))
+	}, func(s string) string {
+		return strings.TrimRight(s, " \t") + " " + f.escape
+	})
+	if len(lines) > 0 {
+		lines[0] = tidy(lines[0])
+	}
+	return lines
+}
+
+// comments returns the comment lines inside n, for instructions that are
+// joined onto one line.
+func (f *formatter) comments(n *parser.Node) []string {
+	out := []string{}
+	for _, line := range f.lines[n.StartLine:n.EndLine] {
+		if tokenComment.MatchString(line) {
+			out = append(out, strings.TrimSpace(line))
+		}
+	}
+	return out
+}
+
+func (f *formatter) conservative(n *parser.Node) []string {
+	return f.relayout(n, func(s string) string {
+		return s
+	}, func(s string) string {
+		return s + f.escape
+	})
+}
+
+// relayout rewrites the physical lines of n. Empty continuation lines
+// are dropped, comments inside the instruction are indented, and the
+// keyword is uppercased; continued and continuation lines are passed
+// through the given functions.
+func (f *formatter) relayout(n *parser.Node, continuation, continued func(string) string) []string {
+	out := []string{}
+	first := true
+	for _, line := range f.lines[n.StartLine-1 : n.EndLine] {
+		if !first && tokenComment.MatchString(line) {
+			out = append(out, indent+strings.TrimSpace(line))
+			continue
+		}
+		if !first && strings.TrimSpace(line) == "" {
+			continue
+		}
+		text := line
+		more := f.continuation.MatchString(line)
+		if more {
+			text = f.continuation.ReplaceAllString(line, "")
+		}
+		if first {
+			text = keyword(strings.TrimLeft(text, " \t\v\f\r"), n)
+		} else {
+			text = continuation(text)
+		}
+		if more {
+			text = continued(text)
+		} else {
+			text = strings.TrimRight(text, " \t")
+		}
+		out = append(out, text)
+		first = false
+	}
+	return out
+}
+
+// singleLine renders an instruction whose arguments are a JSON array on
+// one line, switching to the plain form where that is lossless.
+func (f *formatter) singleLine(n *parser.Node) []string {
+	words := []string{strings.ToUpper(n.Value)}
+	for _, flag := range n.Flags {
+		words = append(words, quoteFlag(flag))
+	}
+	next := n.Next
+	if n.Value == command.Healthcheck && next != nil {
+		words = append(words, strings.ToUpper(next.Value))
+		next = next.Next
+	}
+	args := []string{}
+	plain := formNeutral[n.Value]
+	for a := next; a != nil; a = a.Next {
+		args = append(args, a.Value)
+		plain = plain && plainWord.MatchString(a.Value)
+	}
+	if plain && len(args) > 0 {
+		words = append(words, args...)
+		return []string{strings.Join(words, " ")}
+	}
+	elems := []string{}
+	for _, arg := range args {
+		buf := &bytes.Buffer{}
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(arg); err != nil {
+			return nil
+		}
+		elems = append(elems, strings.TrimSpace(buf.String()))
+	}
+	words = append(words, "["+strings.Join(elems, ", ")+"]")
+	return []string{strings.Join(words, " ")}
+}
+
+// reparses reports whether lines parse back to exactly n.
+func (f *formatter) reparses(lines []string, n *parser.Node) bool {
+	src := strings.Join(lines, "\n") + "\n"
+	if f.escape != string(parser.DefaultEscapeToken) {
+		src = "# escape=" + f.escape + "\n" + src
+	}
+	res, err := parser.Parse(strings.NewReader(src))
+	if err != nil || len(res.AST.Children) != 1 {
+		return false
+	}
+	return Equal(res.AST.Children[0], n)
+}
+
+// keyword uppercases the instruction keyword at the start of line, and
+// the keyword of the trigger of an ONBUILD.
+func keyword(line string, n *parser.Node) string {
+	parts := tokenWhitespace.Split(line, 2)
+	parts[0] = strings.ToUpper(parts[0])
+	if len(parts) == 2 {
+		switch n.Value {
+		case command.Onbuild:
+			if n.Next != nil && len(n.Next.Children) > 0 {
+				parts[1] = keyword(parts[1], n.Next.Children[0])
+			}
+		case command.Healthcheck:
+			parts[1] = upperArg(parts[1], 0, "cmd", "none")
+		case command.From:
+			parts[1] = upperArg(parts[1], 1, "as")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// upperArg uppercases the i-th word of args, not counting flags, if it
+// is one of words. The rest of args is left as it is.
+func upperArg(args string, i int, words ...string) string {
+	start := 0
+	for _, loc := range append(tokenWhitespace.FindAllStringIndex(args, -1), []int{len(args), len(args)}) {
+		word := args[start:loc[0]]
+		start = loc[1]
+		if word == "" || strings.HasPrefix(word, "--") {
+			continue
+		}
+		if i > 0 {
+			i--
+			continue
+		}
+		for _, w := range words {
+			if strings.EqualFold(word, w) {
+				return args[:loc[0]-len(word)] + strings.ToUpper(word) + args[loc[0]:]
+			}
+		}
+		return args
+	}
+	return args
+}
+
+// quoteFlag renders a flag the way extractBuilderFlags reads it back.
+func quoteFlag(flag string) string {
+	if !strings.ContainsAny(flag, " \t\"'\\") {
+		return flag
+	}
+	i := strings.Index(flag, "=") + 1
+	return flag[:i] + `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(flag[i:]) + `"`
+}
+
+// collapseBlanks squeezes runs of blank lines into one and drops blank
+// lines at the end. A leading blank line is kept, since it stops the
+// parser from reading directives.
+func collapseBlanks(lines []string) []string {
+	out := []string{}
+	for i, line := range lines {
+		if line == "" && i > 0 && lines[i-1] == "" {
+			continue
+		}
+		out = append(out, line)
+	}
+	for len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	return out
+}
+
+// splitLines splits src the way the parser's scanner does.
+func splitLines(src []byte) []string {
+	lines := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(src, utf8bom)))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
@@ -0,0 +1,99 @@
+package format
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+func TestFormat(t *testing.T) {
+	for _, tc := range []struct {
+		name, in, want string
+	}{
+		{
+			"keywords",
+			"from alpine as build\nrun echo hi\n",
+			"FROM alpine AS build\nRUN echo hi\n",
+		},
+		{
+			"from flags",
+			"FROM  --platform=linux/amd64 alpine   As base\n",
+			"FROM --platform=linux/amd64 alpine AS base\n",
+		},
+		{
+			"healthcheck",
+			"healthcheck --interval=5s cmd curl -f x\nhealthcheck none\n",
+			"HEALTHCHECK --interval=5s CMD curl -f x\nHEALTHCHECK NONE\n",
+		},
+		{
+			"onbuild",
+			"onbuild run make\nonbuild healthcheck cmd [\"a\",\"b\"]\n",
+			"ONBUILD RUN make\nONBUILD HEALTHCHECK CMD [\"a\",\"b\"]\n",
+		},
+		{
+			// re-indenting would change the command, so only the empty
+			// continuation line goes
+			"continuations",
+			"RUN apt-get update && \\\n\n  apt-get install -y x\n",
+			"RUN apt-get update && \\\n  apt-get install -y x\n",
+		},
+		{
+			"plain copy",
+			"COPY [\"a\", \"b\"]\n",
+			"COPY a b\n",
+		},
+		{
+			"blank lines",
+			"FROM a\n\n\n\nRUN b\n\n",
+			"FROM a\n\nRUN b\n",
+		},
+	} {
+		out, err := Format([]byte(tc.in))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if string(out) != tc.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tc.name, out, tc.want)
+		}
+		again, err := Format(out)
+		if err != nil || string(again) != string(out) {
+			t.Errorf("%s: formatting again gave %q, %v", tc.name, again, err)
+		}
+	}
+}
+
+func TestFormatRejectsUnknownInstructions(t *testing.T) {
+	// the body of a heredoc, which the vendored parser does not know
+	in := "FROM alpine\nRUN <<EOF\necho hi\nEOF\n"
+	if out, err := Format([]byte(in)); err == nil {
+		t.Errorf("formatted to %q, want an error", out)
+	}
+}
+
+func TestEqualFoldsKeywords(t *testing.T) {
+	parse := func(s string) *parser.Node {
+		res, err := parser.Parse(strings.NewReader(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.AST.Children[0]
+	}
+	for _, pair := range [][2]string{
+		{"FROM a as b", "FROM a AS b"},
+		{"HEALTHCHECK cmd true", "HEALTHCHECK CMD true"},
+	} {
+		if !Equal(parse(pair[0]), parse(pair[1])) {
+			t.Errorf("%q and %q differ", pair[0], pair[1])
+		}
+	}
+	for _, pair := range [][2]string{
+		{"FROM a AS b", "FROM a AS c"},
+		{"RUN echo as", "RUN echo AS"},
+	} {
+		if Equal(parse(pair[0]), parse(pair[1])) {
+			t.Errorf("%q and %q are equal", pair[0], pair[1])
+		}
+	}
+}
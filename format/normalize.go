@@ -0,0 +1,65 @@
+package format
+
+import (
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/command"
+)
+
+// Argument returns the i-th argument of the instruction cmd in canonical
+// case: the HEALTHCHECK type and the AS of FROM are uppercased, as the
+// instructions package reads them without case. Other arguments are
+// returned as they are.
+func Argument(cmd string, i int, value string) string {
+	if cmd == command.Healthcheck && i == 0 || cmd == command.From && i == 1 {
+		return strings.ToUpper(value)
+	}
+	return value
+}
+
+// Shell reports whether the i-th argument of the instruction cmd is a
+// shell command, in which blanks outside quotes only separate words: the
+// shell form of RUN, CMD and ENTRYPOINT, and of the command of a
+// HEALTHCHECK.
+func Shell(cmd string, i int, json bool) bool {
+	switch {
+	case json:
+		return false
+	case cmd == command.Run, cmd == command.Cmd, cmd == command.Entrypoint:
+		return true
+	case cmd == command.Healthcheck:
+		return i > 0
+	}
+	return false
+}
+
+// Squeeze collapses runs of spaces and tabs in a shell command into one
+// space and trims them at the ends, leaving quoted and escaped text as
+// it is, so that commands laid out differently but run alike compare
+// equal.
+func Squeeze(s string) string {
+	b := &strings.Builder{}
+	var quote rune
+	escaped, space := false, false
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == 0 && (r == ' ' || r == '\t'):
+			space = true
+			continue
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case r == quote:
+			quote = 0
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
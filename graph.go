@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/btwiuse/buildahfy/graph"
+	"github.com/btwiuse/buildahfy/imageconfig"
+	"github.com/btwiuse/buildahfy/llbdump"
+	"github.com/btwiuse/buildahfy/step"
+	"github.com/btwiuse/buildahfy/translate"
+	"github.com/po3rin/dockerdot/docker2dot"
+)
+
+// graphMain renders the Dockerfile on stdin as Graphviz DOT.
+func graphMain(args []string) {
+	opt := llbdump.Options{BuildArgs: kvFlag{}}
+	kind, layout, dockerdot := "", "", false
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+	fs.StringVar(&kind, "kind", "stages", "graph to render: stages or llb")
+	fs.BoolVar(&dockerdot, "dockerdot", false, "render the llb graph with plain docker2dot, resolving base images from their registries")
+	fs.StringVar(&opt.Target, "target", "", "stage to convert for the llb graph, or to mark as the target in the stages graph")
+	fs.StringVar(&layout, "layout", "", "OCI layout directory holding base images")
+	fs.Var(kvFlag(opt.BuildArgs), "build-arg", "build-time variable `key=value`")
+	fs.Parse(args)
+	if layout != "" {
+		opt.Resolver = &imageconfig.Layout{Dir: layout}
+	}
+	dt, err := readFile("-")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if dockerdot {
+		out, err := docker2dot.Docker2Dot(dt)
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Stdout.Write(out)
+		return
+	}
+	steps, err := step.Parse(bytes.NewReader(dt))
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch kind {
+	case "stages":
+		if err := graph.Stages(os.Stdout, steps, opt.Target, translate.Instruction); err != nil {
+			log.Fatal(err)
+		}
+	case "llb":
+		def, err := llbdump.Convert(dt, opt)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ops, err := llbdump.Ops(def)
+		if err != nil {
+			log.Fatal(err)
+		}
+		graph.LLB(os.Stdout, ops, steps, translate.Instruction)
+	default:
+		log.Fatalf("unknown graph %q", kind)
+	}
+}
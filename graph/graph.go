@@ -0,0 +1,54 @@
+// Package graph renders Dockerfiles as Graphviz DOT, either as the
+// dependency graph between stages or as the LLB op graph BuildKit would
+// solve. Every node names the Dockerfile lines behind it and the buildah
+// command they become.
+package graph
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/step"
+)
+
+// Translator returns the buildah command for an instruction, or "" if
+// there is none.
+type Translator func(ins interface{}) string
+
+// label builds a node label from a heading and the steps behind it.
+func label(heading string, steps []step.Step, translate Translator) string {
+	lines := []string{heading}
+	for _, s := range steps {
+		lines = append(lines, fmt.Sprintf("%s: %s", lineRange(s), s.Source()))
+		if translate == nil {
+			continue
+		}
+		if cmd := translate(s.Instruction); cmd != "" {
+			lines = append(lines, "  "+cmd)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func lineRange(s step.Step) string {
+	if s.Node.StartLine == s.Node.EndLine {
+		return "line " + strconv.Itoa(s.Node.StartLine)
+	}
+	return fmt.Sprintf("lines %d-%d", s.Node.StartLine, s.Node.EndLine)
+}
+
+// quote renders s as a DOT string with left-justified lines.
+func quote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\l`).Replace(s)
+	return `"` + s + `\l"`
+}
+
+func node(w io.Writer, id, label, shape string) {
+	fmt.Fprintf(w, "  %q [label=%s shape=%q];\n", id, quote(label), shape)
+}
+
+func edge(w io.Writer, from, to, label string) {
+	fmt.Fprintf(w, "  %q -> %q [label=%q];\n", from, to, label)
+}
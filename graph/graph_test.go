@@ -0,0 +1,92 @@
+package graph
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/btwiuse/buildahfy/llbdump"
+	"github.com/btwiuse/buildahfy/step"
+)
+
+const dockerfile = `FROM golang:1.12 AS build
+RUN go build -o /app
+FROM alpine AS base
+FROM base
+COPY --from=build /app /app
+COPY --from=busybox /bin/sh /bin/sh
+`
+
+func parse(t *testing.T) []step.Step {
+	steps, err := step.Parse(strings.NewReader(dockerfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return steps
+}
+
+func TestStages(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := Stages(buf, parse(t), "", nil); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, line := range []string{
+		`"image:golang:1.12" -> "stage-0" [label="FROM"];`,
+		`"image:alpine" -> "stage-1" [label="FROM"];`,
+		`"stage-1" -> "stage-2" [label="FROM"];`,
+		`"stage-0" -> "stage-2" [label="COPY --from, line 5"];`,
+		`"image:busybox" -> "stage-2" [label="COPY --from, line 6"];`,
+		`"stage-2" [label="stage-2 (target)\lline 4: FROM base\l`,
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("missing %s in\n%s", line, out)
+		}
+	}
+	if strings.Count(out, `"image:golang:1.12" [`) != 1 {
+		t.Errorf("golang is drawn more than once:\n%s", out)
+	}
+}
+
+func TestStagesTarget(t *testing.T) {
+	buf := &bytes.Buffer{}
+	translate := func(ins interface{}) string { return "buildah ..." }
+	if err := Stages(buf, parse(t), "BUILD", translate); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"stage-0" [label="build (target)\lline 1: FROM golang:1.12 AS build\l  buildah ...\l`) {
+		t.Errorf("build is not the target:\n%s", buf)
+	}
+	if err := Stages(&bytes.Buffer{}, parse(t), "missing", nil); err == nil {
+		t.Error("a missing target was accepted")
+	}
+}
+
+func TestLLB(t *testing.T) {
+	def, err := llbdump.Convert([]byte(dockerfile), llbdump.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops, err := llbdump.Ops(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	LLB(buf, ops, parse(t), nil)
+	out := buf.String()
+	// every step that yields an op labels it, FROM and RUN by their
+	// command and COPY by its custom name
+	for _, source := range []string{
+		`line 1: FROM golang:1.12 AS build`,
+		`line 2: RUN go build -o /app`,
+		`line 5: COPY --from=build /app /app`,
+		`line 6: COPY --from=busybox /bin/sh /bin/sh`,
+	} {
+		if !strings.Contains(out, source) {
+			t.Errorf("no op is labelled %s:\n%s", source, out)
+		}
+	}
+	if n := strings.Count(out, " -> "); n < 4 {
+		t.Errorf("%d edges, want the inputs of RUN and both COPYs:\n%s", n, out)
+	}
+}
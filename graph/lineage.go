@@ -0,0 +1,47 @@
+package graph
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Lineage renders which images are built from which: lineage maps each
+// locally built image to its bases. Local images are boxes and the bases
+// nobody here builds are ellipses; images that are bases for other local
+// images are filled, since those are the ones to maintain.
+func Lineage(w io.Writer, lineage map[string][]string) {
+	images := []string{}
+	bases := map[string]bool{}
+	for image, from := range lineage {
+		images = append(images, image)
+		for _, base := range from {
+			bases[base] = true
+		}
+	}
+	sort.Strings(images)
+	fmt.Fprintln(w, "digraph {")
+	defer fmt.Fprintln(w, "}")
+	for _, image := range images {
+		style := ""
+		if bases[image] {
+			style = " style=filled"
+		}
+		fmt.Fprintf(w, "  %q [shape=box%s];\n", image, style)
+	}
+	external := []string{}
+	for base := range bases {
+		if _, ok := lineage[base]; !ok {
+			external = append(external, base)
+		}
+	}
+	sort.Strings(external)
+	for _, base := range external {
+		fmt.Fprintf(w, "  %q [shape=ellipse];\n", base)
+	}
+	for _, image := range images {
+		for _, base := range lineage[image] {
+			edge(w, base, image, "")
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package graph
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/llbdump"
+	"github.com/btwiuse/buildahfy/step"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/moby/buildkit/solver/pb"
+)
+
+// LLB writes the op graph of a converted Dockerfile, labelling each op
+// with the step that produced it. Ops are drawn as docker2dot draws
+// them.
+func LLB(w io.Writer, ops []llbdump.Op, steps []step.Step, translate Translator) {
+	fmt.Fprintln(w, "digraph {")
+	defer fmt.Fprintln(w, "}")
+	m := newMatcher(steps)
+	for _, op := range ops {
+		if op.Op.Op == nil { // the output vertex
+			continue
+		}
+		name, shape := attr(op.Op)
+		if s, ok := m.match(op); ok {
+			name = label(name, []step.Step{s}, translate)
+		}
+		node(w, op.Digest.String(), name, shape)
+	}
+	for _, op := range ops {
+		if op.Op.Op == nil {
+			continue
+		}
+		for i, inp := range op.Op.Inputs {
+			label := ""
+			if eo, ok := op.Op.Op.(*pb.Op_Exec); ok {
+				for _, m := range eo.Exec.Mounts {
+					if int(m.Input) == i && m.Dest != "/" {
+						label = m.Dest
+					}
+				}
+			}
+			edge(w, inp.Digest.String(), op.Digest.String(), label)
+		}
+	}
+}
+
+// matcher finds the step behind an op. dockerfile2llb records the source
+// of FROM and RUN as the op's command, but file ops such as COPY, ADD and
+// WORKDIR only carry a custom name like "[2/5] COPY a b".
+type matcher struct {
+	steps []step.Step
+	used  map[*parser.Node]bool
+}
+
+var stepPrefix = regexp.MustCompile(`^\[[^]]*\] `)
+
+func newMatcher(steps []step.Step) *matcher {
+	return &matcher{steps: steps, used: map[*parser.Node]bool{}}
+}
+
+func (m *matcher) match(op llbdump.Op) (step.Step, bool) {
+	if cmd := op.OpMetadata.Description["com.docker.dockerfile.v1.command"]; cmd != "" {
+		return m.find(func(s step.Step) bool {
+			return s.Source() == cmd
+		})
+	}
+	name := stepPrefix.ReplaceAllString(op.OpMetadata.Description["llb.customname"], "")
+	if s, ok := m.find(func(s step.Step) bool {
+		return uppercaseCmd(s.Source()) == name
+	}); ok {
+		return s, true
+	}
+	// arguments may have been expanded; fall back to the keyword
+	keyword := strings.SplitN(name, " ", 2)[0]
+	return m.find(func(s step.Step) bool {
+		return strings.EqualFold(s.Node.Value, keyword) && s.Node.Value != "from" && s.Node.Value != "run"
+	})
+}
+
+// find returns the first unmatched step satisfying pred, or the last
+// matched one when identical ops share a step.
+func (m *matcher) find(pred func(step.Step) bool) (step.Step, bool) {
+	last, found := step.Step{}, false
+	for _, s := range m.steps {
+		if !pred(s) {
+			continue
+		}
+		if !m.used[s.Node] {
+			m.used[s.Node] = true
+			return s, true
+		}
+		last, found = s, true
+	}
+	return last, found
+}
+
+// uppercaseCmd mirrors the dockerfile2llb helper of the same name.
+func uppercaseCmd(str string) string {
+	p := strings.SplitN(str, " ", 2)
+	p[0] = strings.ToUpper(p[0])
+	return strings.Join(p, " ")
+}
+
+// adapted from docker2dot
+func attr(op pb.Op) (string, string) {
+	switch op := op.Op.(type) {
+	case *pb.Op_Source:
+		return op.Source.Identifier, "ellipse"
+	case *pb.Op_Exec:
+		return strings.Join(op.Exec.Meta.Args, " "), "box"
+	case *pb.Op_Build:
+		return "build", "box3d"
+	case *pb.Op_File:
+		names := []string{}
+		for _, action := range op.File.Actions {
+			switch act := action.Action.(type) {
+			case *pb.FileAction_Copy:
+				names = append(names, fmt.Sprintf("copy{src=%s, dest=%s}", act.Copy.Src, act.Copy.Dest))
+			case *pb.FileAction_Mkfile:
+				names = append(names, fmt.Sprintf("mkfile{path=%s}", act.Mkfile.Path))
+			case *pb.FileAction_Mkdir:
+				names = append(names, fmt.Sprintf("mkdir{path=%s}", act.Mkdir.Path))
+			case *pb.FileAction_Rm:
+				names = append(names, fmt.Sprintf("rm{path=%s}", act.Rm.Path))
+			}
+		}
+		return strings.Join(names, ","), "note"
+	}
+	return "", "plaintext"
+}
@@ -0,0 +1,71 @@
+package graph
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/step"
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/pkg/errors"
+)
+
+// Stages writes the dependency graph between the stages of a Dockerfile.
+// Stages are boxes and external images ellipses; edges follow FROM and
+// COPY --from, so stages without a path between them can build in
+// parallel. The target stage, the last one unless target names another,
+// is marked as such.
+func Stages(w io.Writer, steps []step.Step, target string, translate Translator) error {
+	_, stages := step.Stages(steps)
+	selected := len(stages) - 1
+	if target != "" {
+		selected = -1
+		for i, st := range stages {
+			if strings.EqualFold(st[0].Instruction.(*instructions.Stage).Name, target) {
+				selected = i
+			}
+		}
+		if selected < 0 {
+			return errors.Errorf("target stage %s could not be found", target)
+		}
+	}
+	fmt.Fprintln(w, "digraph {")
+	defer fmt.Fprintln(w, "}")
+	ids := map[string]string{}
+	images := map[string]bool{}
+	source := func(ref string) string {
+		if id, ok := ids[strings.ToLower(ref)]; ok {
+			return id
+		}
+		id := "image:" + ref
+		if !images[id] {
+			images[id] = true
+			node(w, id, ref, "ellipse")
+		}
+		return id
+	}
+	for i, st := range stages {
+		stage := st[0].Instruction.(*instructions.Stage)
+		id := "stage-" + strconv.Itoa(i)
+		heading := id
+		if stage.Name != "" {
+			heading = stage.Name
+		}
+		if i == selected {
+			heading += " (target)"
+		}
+		node(w, id, label(heading, st, translate), "box")
+		edge(w, source(stage.BaseName), id, "FROM")
+		for _, s := range st[1:] {
+			if c, ok := s.Instruction.(*instructions.CopyCommand); ok && c.From != "" {
+				edge(w, source(c.From), id, "COPY --from, "+lineRange(s))
+			}
+		}
+		if stage.Name != "" {
+			ids[strings.ToLower(stage.Name)] = id
+		}
+		ids[strconv.Itoa(i)] = id
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/imageconfig"
+	"github.com/btwiuse/pretty"
+)
+
+// kvFlag collects repeated key=value flags such as --build-arg.
+type kvFlag map[string]string
+
+func (kv kvFlag) String() string {
+	pairs := []string{}
+	for k, v := range kv {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (kv kvFlag) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) == 1 {
+		kv[parts[0]] = os.Getenv(parts[0])
+		return nil
+	}
+	kv[parts[0]] = parts[1]
+	return nil
+}
+
+// imageConfigMain prints the image config the Dockerfile on stdin would
+// produce, without running buildah.
+func imageConfigMain(args []string) {
+	opt := imageconfig.Options{BuildArgs: kvFlag{}}
+	layout := ""
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	fs.StringVar(&opt.Target, "target", "", "stage to compute the config of")
+	fs.StringVar(&layout, "layout", "", "OCI layout directory holding base images")
+	fs.Var(kvFlag(opt.BuildArgs), "build-arg", "build-time variable `key=value`")
+	fs.Parse(args)
+	if layout != "" {
+		opt.Resolver = &imageconfig.Layout{Dir: layout}
+	}
+	dt, err := readFile("-")
+	if err != nil {
+		panic(err)
+	}
+	img, err := imageconfig.Compute(dt, opt)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pretty.Json(img)
+}
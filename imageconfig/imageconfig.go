@@ -0,0 +1,43 @@
+// Package imageconfig computes the image config a Dockerfile produces
+// without running a build.
+package imageconfig
+
+import (
+	"context"
+
+	"github.com/containerd/containerd/platforms"
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/frontend/dockerfile/dockerfile2llb"
+)
+
+type Options struct {
+	Target    string
+	BuildArgs map[string]string
+	// Resolver provides base image configs. Nil means Offline.
+	Resolver llb.ImageMetaResolver
+}
+
+// Compute returns the OCI/Docker image config of the target stage:
+// Env, Cmd, Entrypoint, ExposedPorts, Volumes, Labels, WorkingDir, User,
+// StopSignal, Healthcheck, Shell and OnBuild. Base images the resolver
+// does not know start from an empty config.
+func Compute(dt []byte, opt Options) (*dockerfile2llb.Image, error) {
+	resolver := opt.Resolver
+	if resolver == nil {
+		resolver = Offline{}
+	}
+	_, img, err := dockerfile2llb.Dockerfile2LLB(context.TODO(), dt, dockerfile2llb.ConvertOpt{
+		Target:       opt.Target,
+		BuildArgs:    opt.BuildArgs,
+		MetaResolver: resolver,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// unresolved bases carry no platform of their own
+	if img.OS == "" {
+		platform := platforms.DefaultSpec()
+		img.OS, img.Architecture, img.Variant = platform.OS, platform.Architecture, platform.Variant
+	}
+	return img, nil
+}
@@ -0,0 +1,129 @@
+package imageconfig
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestComputeOffline(t *testing.T) {
+	dt := []byte(`FROM alpine AS build
+ENV A=1
+FROM build
+ARG PORT=80
+ENV B=2
+EXPOSE $PORT
+WORKDIR /srv
+USER nobody
+LABEL org.example=yes
+ENTRYPOINT ["/bin/app"]
+CMD ["serve"]
+`)
+	img, err := Compute(dt, Options{BuildArgs: map[string]string{"PORT": "8080"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := img.Config
+	if !reflect.DeepEqual(c.Env[len(c.Env)-2:], []string{"A=1", "B=2"}) {
+		t.Errorf("env %q, want A and B from both stages", c.Env)
+	}
+	if _, ok := c.ExposedPorts["8080/tcp"]; !ok {
+		t.Errorf("exposed ports %v, want the build arg", c.ExposedPorts)
+	}
+	if c.WorkingDir != "/srv" || c.User != "nobody" || c.Labels["org.example"] != "yes" {
+		t.Errorf("workdir %q, user %q, labels %v", c.WorkingDir, c.User, c.Labels)
+	}
+	if !reflect.DeepEqual(c.Entrypoint, []string{"/bin/app"}) || !reflect.DeepEqual(c.Cmd, []string{"serve"}) {
+		t.Errorf("entrypoint %q, cmd %q", c.Entrypoint, c.Cmd)
+	}
+	if img.OS == "" || img.Architecture == "" {
+		t.Errorf("no platform in %+v", img.Image)
+	}
+
+	img, err = Compute(dt, Options{Target: "build"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Config.Cmd != nil || img.Config.User != "" {
+		t.Errorf("target build has the config of the last stage: %+v", img.Config)
+	}
+}
+
+// writeLayout writes an OCI layout holding a single image, tagged name,
+// whose config is config.
+func writeLayout(t *testing.T, dir, name string, config interface{}) {
+	blob := func(v interface{}) specs.Descriptor {
+		dt, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := digest.FromBytes(dt)
+		path := filepath.Join(dir, "blobs", d.Algorithm().String(), d.Hex())
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, dt, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return specs.Descriptor{Digest: d, Size: int64(len(dt))}
+	}
+	cfg := blob(config)
+	cfg.MediaType = specs.MediaTypeImageConfig
+	manifest := blob(specs.Manifest{Config: cfg})
+	manifest.MediaType = specs.MediaTypeImageManifest
+	manifest.Annotations = map[string]string{specs.AnnotationRefName: name}
+	dt, err := json.Marshal(specs.Index{Manifests: []specs.Descriptor{manifest}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.json"), dt, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestComputeLayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	base := specs.Image{
+		OS:           "linux",
+		Architecture: "arm64",
+		Config: specs.ImageConfig{
+			Env:        []string{"PATH=/usr/bin", "BASE=1"},
+			WorkingDir: "/base",
+			Cmd:        []string{"sh"},
+		},
+	}
+	writeLayout(t, dir, "docker.io/library/base:1.0", base)
+
+	// a layout may tag the image by its full name, its familiar name or
+	// only the tag; this one uses the full name
+	for _, from := range []string{"base:1.0", "docker.io/library/base:1.0"} {
+		img, err := Compute([]byte("FROM "+from+"\nENV APP=2\n"), Options{Resolver: &Layout{Dir: dir}})
+		if err != nil {
+			t.Fatalf("%s: %v", from, err)
+		}
+		if img.Architecture != "arm64" || img.Config.WorkingDir != "/base" || !reflect.DeepEqual(img.Config.Cmd, []string{"sh"}) {
+			t.Errorf("%s: %+v does not start from the base config", from, img.Image)
+		}
+		if want := []string{"PATH=/usr/bin", "BASE=1", "APP=2"}; !reflect.DeepEqual(img.Config.Env, want) {
+			t.Errorf("%s: env %q, want %q", from, img.Config.Env, want)
+		}
+	}
+
+	img, err := Compute([]byte("FROM other\n"), Options{Resolver: &Layout{Dir: dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Config.WorkingDir != "" || img.Config.Cmd != nil {
+		t.Errorf("an image missing from the layout has config %+v, want it empty", img.Config)
+	}
+}
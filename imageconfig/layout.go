@@ -0,0 +1,111 @@
+package imageconfig
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	"github.com/docker/distribution/reference"
+	gw "github.com/moby/buildkit/frontend/gateway/client"
+	digest "github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// annotationImageName is the annotation containerd uses to record the
+// full image name in the layouts it exports.
+const annotationImageName = "io.containerd.image.name"
+
+// Layout resolves base image configs from a local OCI image layout
+// directory instead of a registry.
+type Layout struct {
+	Dir string
+}
+
+// Offline never resolves anything, so every base image is treated as
+// having an empty config.
+type Offline struct{}
+
+func (Offline) ResolveImageConfig(ctx context.Context, ref string, opt gw.ResolveImageConfigOpt) (digest.Digest, []byte, error) {
+	return "", nil, errors.Errorf("%s: offline", ref)
+}
+
+func (l *Layout) ResolveImageConfig(ctx context.Context, ref string, opt gw.ResolveImageConfigOpt) (digest.Digest, []byte, error) {
+	index := &specs.Index{}
+	if err := l.readJSON(filepath.Join(l.Dir, "index.json"), index); err != nil {
+		return "", nil, err
+	}
+	names := refNames(ref)
+	for _, desc := range index.Manifests {
+		if !names[desc.Annotations[specs.AnnotationRefName]] && !names[desc.Annotations[annotationImageName]] {
+			continue
+		}
+		platform := platforms.DefaultSpec()
+		if opt.Platform != nil {
+			platform = *opt.Platform
+		}
+		return l.config(desc, platforms.Only(platform))
+	}
+	return "", nil, errors.Errorf("%s: not found in %s", ref, l.Dir)
+}
+
+// config follows desc down to an image config blob, picking the
+// manifest matching platform out of any index it meets on the way.
+func (l *Layout) config(desc specs.Descriptor, platform platforms.MatchComparer) (digest.Digest, []byte, error) {
+	switch desc.MediaType {
+	case specs.MediaTypeImageIndex, images.MediaTypeDockerSchema2ManifestList:
+		index := &specs.Index{}
+		if err := l.readJSON(l.blob(desc.Digest), index); err != nil {
+			return "", nil, err
+		}
+		for _, m := range index.Manifests {
+			if m.Platform == nil || platform.Match(*m.Platform) {
+				return l.config(m, platform)
+			}
+		}
+		return "", nil, errors.Errorf("%s: no manifest for platform", desc.Digest)
+	case specs.MediaTypeImageManifest, images.MediaTypeDockerSchema2Manifest:
+		manifest := &specs.Manifest{}
+		if err := l.readJSON(l.blob(desc.Digest), manifest); err != nil {
+			return "", nil, err
+		}
+		dt, err := ioutil.ReadFile(l.blob(manifest.Config.Digest))
+		if err != nil {
+			return "", nil, err
+		}
+		return desc.Digest, dt, nil
+	}
+	return "", nil, errors.Errorf("%s: unsupported media type %s", desc.Digest, desc.MediaType)
+}
+
+func (l *Layout) blob(d digest.Digest) string {
+	return filepath.Join(l.Dir, "blobs", d.Algorithm().String(), d.Hex())
+}
+
+func (l *Layout) readJSON(path string, v interface{}) error {
+	dt, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(json.Unmarshal(dt, v), path)
+}
+
+// refNames lists the spellings a layout may use to tag ref: the fully
+// qualified name, the familiar docker name and the bare tag.
+func refNames(ref string) map[string]bool {
+	names := map[string]bool{ref: true}
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return names
+	}
+	named = reference.TagNameOnly(named)
+	names[named.String()] = true
+	names[reference.FamiliarString(named)] = true
+	if tagged, ok := named.(reference.Tagged); ok {
+		names[tagged.Tag()] = true
+	}
+	return names
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/btwiuse/buildahfy/corpus"
+	"github.com/pkg/errors"
+)
+
+// inputFlags select where corpus records come from.
+type inputFlags struct {
+	input      string
+	id         string
+	contents   string
+	quarantine string
+	timeout    time.Duration
+}
+
+func addInputFlags(fs *flag.FlagSet) *inputFlags {
+	in := &inputFlags{}
+	fs.StringVar(&in.input, "input", "pd", "corpus input as `kind[:path]`: pd, ndjson or tar read path or stdin, dir and git read the tree or history at path")
+	fs.StringVar(&in.id, "id-field", "Id", "dotted path of the record Id in ndjson input")
+	fs.StringVar(&in.contents, "contents-field", "Value.Contents", "dotted path of the Dockerfile in ndjson input")
+	fs.StringVar(&in.quarantine, "quarantine", "", "write records that do not decode, panic or time out to `file` as ndjson instead of logging them")
+	fs.DurationVar(&in.timeout, "timeout", 30*time.Second, "set aside records that take longer than this; 0 for no limit")
+	return in
+}
+
+// open returns the selected source and a function that releases it.
+func (in *inputFlags) open() (corpus.Source, func(), error) {
+	parts := strings.SplitN(in.input, ":", 2)
+	kind, path := parts[0], ""
+	if len(parts) == 2 {
+		path = parts[1]
+	}
+	switch kind {
+	case "dir":
+		src, err := corpus.NewDir(orDot(path))
+		return src, func() {}, err
+	case "git":
+		src, err := corpus.NewGit(orDot(path))
+		return src, func() {}, err
+	case "pd", "ndjson", "tar":
+	default:
+		return nil, nil, errors.Errorf("unknown input kind %q", kind)
+	}
+	f, done := os.Stdin, func() {}
+	if path != "" && path != "-" {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return nil, nil, err
+		}
+		done = func() { f.Close() }
+	}
+	switch kind {
+	case "ndjson":
+		return corpus.NewNDJSON(f, in.id, in.contents), done, nil
+	case "tar":
+		src, err := corpus.NewTar(f)
+		if err != nil {
+			done()
+			return nil, nil, err
+		}
+		return src, done, nil
+	}
+	return corpus.NewStream(f), done, nil
+}
+
+func orDot(path string) string {
+	if path == "" {
+		return "."
+	}
+	return path
+}
+
+// mapRecords runs corpus.Map over the selected input until it ends or
+// SIGINT arrives. ck may be nil for runs that cannot resume.
+func (in *inputFlags) mapRecords(ck *checkpointFlags, jobs int, fn func(*corpus.Record) interface{}, emit func(*corpus.Record, interface{}) error) error {
+	src, done, err := in.open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer done()
+	set, closeQuarantine := in.openQuarantine(ck)
+	defer closeQuarantine()
+	quarantined := func(rec *corpus.Record, res interface{}) error {
+		if q, ok := res.(*corpus.Quarantined); ok {
+			return set(q)
+		}
+		return emit(rec, res)
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	// skip the finished records first, so that the bad input among them,
+	// or recorded as quarantined, is not quarantined again
+	src = corpus.Skip(ck.source(src), ck.quarantine(set))
+	return corpus.Map(ctx, src, jobs, corpus.Guard(fn, in.timeout), ck.emit(quarantined))
+}
+
+// mapFailed ends a run whose mapRecords returned err. An interrupted
+// run is not a bug: it is logged and exits with status 1.
+func mapFailed(err error) {
+	if errors.Cause(err) == context.Canceled {
+		log.Println("interrupted")
+		os.Exit(1)
+	}
+	panic(err)
+}
+
+// openQuarantine returns where quarantined records go: the -quarantine
+// file, appended to when resuming, or the log.
+func (in *inputFlags) openQuarantine(ck *checkpointFlags) (func(*corpus.Quarantined) error, func()) {
+	if in.quarantine == "" {
+		return func(q *corpus.Quarantined) error {
+			log.Println("quarantined", q)
+			return nil
+		}, func() {}
+	}
+	mode := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if ck != nil && ck.resume {
+		mode = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(in.quarantine, mode, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+	enc := json.NewEncoder(f)
+	return func(q *corpus.Quarantined) error {
+		return enc.Encode(q)
+	}, func() { f.Close() }
+}
+
+// checkFormat exits unless format is one of those a subcommand writes,
+// so that a typo is caught before the corpus is read.
+func checkFormat(format string, formats ...string) {
+	for _, f := range formats {
+		if format == f {
+			return
+		}
+	}
+	log.Fatalf("unknown format %q", format)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/btwiuse/buildahfy/imageconfig"
+	"github.com/btwiuse/buildahfy/llbdump"
+	"github.com/containerd/containerd/platforms"
+)
+
+// llbMain dumps the LLB of the Dockerfile on stdin, replacing
+// `dockerfile2llb | buildctl debug dump-llb | jq -s . | yj -jy`.
+func llbMain(args []string) {
+	opt := llbdump.Options{BuildArgs: kvFlag{}}
+	format, platform, layout := "", "", ""
+	fs := flag.NewFlagSet("llb", flag.ExitOnError)
+	fs.StringVar(&format, "format", "yaml", "output format: yaml, json or pb")
+	fs.StringVar(&opt.Target, "target", "", "stage to convert")
+	fs.StringVar(&platform, "platform", "", "target platform, e.g. linux/arm64")
+	fs.StringVar(&layout, "layout", "", "OCI layout directory holding base images")
+	fs.Var(kvFlag(opt.BuildArgs), "build-arg", "build-time variable `key=value`")
+	fs.Parse(args)
+	if platform != "" {
+		p, err := platforms.Parse(platform)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opt.Platform = &p
+	}
+	if layout != "" {
+		opt.Resolver = &imageconfig.Layout{Dir: layout}
+	}
+	dt, err := readFile("-")
+	if err != nil {
+		log.Fatal(err)
+	}
+	def, err := llbdump.Convert(dt, opt)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if format == "pb" {
+		if err := llbdump.WriteProto(os.Stdout, def); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	ops, err := llbdump.Ops(def)
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch format {
+	case "json":
+		err = llbdump.WriteJSON(os.Stdout, ops)
+	case "yaml":
+		err = llbdump.WriteYAML(os.Stdout, ops)
+	default:
+		log.Fatalf("unknown format %q", format)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,99 @@
+// Package llbdump converts Dockerfiles to LLB in process and dumps the
+// result the way `buildctl debug dump-llb` does, without a daemon.
+package llbdump
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/btwiuse/buildahfy/imageconfig"
+	"github.com/ghodss/yaml"
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/frontend/dockerfile/dockerfile2llb"
+	"github.com/moby/buildkit/solver/pb"
+	digest "github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+type Options struct {
+	Target    string
+	BuildArgs map[string]string
+	// Platform is the target platform. Nil means the host platform.
+	Platform *specs.Platform
+	// Resolver provides base image configs. Nil means imageconfig.Offline.
+	Resolver llb.ImageMetaResolver
+}
+
+// Op is one vertex of an LLB definition, laid out like the records
+// buildctl debug dump-llb prints.
+type Op struct {
+	Op         pb.Op
+	Digest     digest.Digest
+	OpMetadata pb.OpMetadata
+}
+
+// Convert builds the LLB definition of a Dockerfile with every LLB
+// capability enabled, as the dockerfile2llb example tool does.
+func Convert(dt []byte, opt Options) (*llb.Definition, error) {
+	resolver := opt.Resolver
+	if resolver == nil {
+		resolver = imageconfig.Offline{}
+	}
+	caps := pb.Caps.CapSet(pb.Caps.All())
+	st, _, err := dockerfile2llb.Dockerfile2LLB(context.TODO(), dt, dockerfile2llb.ConvertOpt{
+		Target:         opt.Target,
+		BuildArgs:      opt.BuildArgs,
+		TargetPlatform: opt.Platform,
+		MetaResolver:   resolver,
+		LLBCaps:        &caps,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return st.Marshal()
+}
+
+// Ops decodes the vertices of def in definition order.
+func Ops(def *llb.Definition) ([]Op, error) {
+	ops := []Op{}
+	for _, dt := range def.Def {
+		op := Op{Digest: digest.FromBytes(dt)}
+		if err := op.Op.Unmarshal(dt); err != nil {
+			return nil, err
+		}
+		op.OpMetadata = def.Metadata[op.Digest]
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// WriteJSON writes the ops as one indented JSON array, like
+// `buildctl debug dump-llb | jq -s .`.
+func WriteJSON(w io.Writer, ops []Op) error {
+	dt, err := json.MarshalIndent(ops, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(dt, '\n'))
+	return err
+}
+
+// WriteYAML writes the ops as YAML, like piping the JSON through yj -jy.
+func WriteYAML(w io.Writer, ops []Op) error {
+	dt, err := json.Marshal(ops)
+	if err != nil {
+		return err
+	}
+	if dt, err = yaml.JSONToYAML(dt); err != nil {
+		return err
+	}
+	_, err = w.Write(dt)
+	return err
+}
+
+// WriteProto writes def as a serialized pb.Definition, the format
+// buildctl build and dump-llb read on stdin.
+func WriteProto(w io.Writer, def *llb.Definition) error {
+	return llb.WriteTo(def, w)
+}
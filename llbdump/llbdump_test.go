@@ -0,0 +1,100 @@
+package llbdump
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/client/llb"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const dockerfile = "FROM golang:1.12 AS build\nARG VERSION=dev\nRUN go build -ldflags=-X=main.version=$VERSION\nFROM alpine\nCOPY --from=build /app /app\n"
+
+// images returns the source identifiers of ops.
+func images(ops []Op) []string {
+	ids := []string{}
+	for _, op := range ops {
+		if src := op.Op.GetSource(); src != nil {
+			ids = append(ids, src.Identifier)
+		}
+	}
+	return ids
+}
+
+func convert(t *testing.T, opt Options) []Op {
+	def, err := Convert([]byte(dockerfile), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops, err := Ops(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ops
+}
+
+func TestConvertOptions(t *testing.T) {
+	if got := images(convert(t, Options{Target: "build"})); len(got) != 1 || !strings.Contains(got[0], "golang") {
+		t.Errorf("target build pulls %v, want golang alone", got)
+	}
+
+	ops := convert(t, Options{BuildArgs: map[string]string{"VERSION": "1.0"}})
+	found := false
+	for _, op := range ops {
+		if exec := op.Op.GetExec(); exec != nil {
+			found = found || strings.Contains(strings.Join(exec.Meta.Env, " "), "VERSION=1.0")
+		}
+	}
+	if !found {
+		t.Error("the build arg is not in the environment of RUN")
+	}
+
+	arm := &specs.Platform{OS: "linux", Architecture: "arm64"}
+	for _, op := range convert(t, Options{Platform: arm}) {
+		if p := op.Op.Platform; p != nil && p.Architecture != "arm64" {
+			t.Errorf("op %s is for %s, want arm64", op.Digest, p.Architecture)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	def, err := Convert([]byte(dockerfile), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops, err := Ops(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteJSON(buf, ops); err != nil {
+		t.Fatal(err)
+	}
+	records := []map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &records); err != nil || len(records) != len(ops) {
+		t.Errorf("JSON holds %d records (%v), want %d", len(records), err, len(ops))
+	}
+
+	buf.Reset()
+	if err := WriteYAML(buf, ops); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "\n- "); n+1 != len(ops) {
+		t.Errorf("YAML lists %d ops, want %d", n+1, len(ops))
+	}
+
+	buf.Reset()
+	if err := WriteProto(buf, def); err != nil {
+		t.Fatal(err)
+	}
+	read, err := llb.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Def) != len(def.Def) {
+		t.Errorf("read back %d ops, want %d", len(read.Def), len(def.Def))
+	}
+}
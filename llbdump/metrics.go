@@ -0,0 +1,111 @@
+package llbdump
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/moby/buildkit/solver/pb"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// Metrics describe the shape of an LLB graph.
+type Metrics struct {
+	// Ops counts the vertices by type: source, exec, file or build. The
+	// final vertex, which only names the result, is left out.
+	Ops   map[string]int `json:"ops"`
+	Total int            `json:"total"`
+	// Depth is the number of vertices on the longest path through the
+	// graph, and Width the most vertices at the same depth: the length of
+	// the critical path and how many vertices BuildKit may solve at once.
+	Depth int `json:"depth"`
+	Width int `json:"width"`
+	// Parallelism is Total over Depth, 1 for a graph as linear as a
+	// buildah script.
+	Parallelism float64 `json:"parallelism"`
+	// Images are the distinct images the graph builds from, and Sources
+	// all its distinct source identifiers, such as local://context.
+	Images  []string `json:"images"`
+	Sources []string `json:"sources"`
+	// Caps are the LLB capabilities the vertices request.
+	Caps []string `json:"caps"`
+}
+
+// Measure computes the metrics of ops as returned by Ops.
+func Measure(ops []Op) *Metrics {
+	m := &Metrics{Ops: map[string]int{}, Images: []string{}, Sources: []string{}, Caps: []string{}}
+	byDigest := map[digest.Digest]*Op{}
+	for i := range ops {
+		byDigest[ops[i].Digest] = &ops[i]
+	}
+	depths := map[digest.Digest]int{}
+	var depth func(op *Op) int
+	depth = func(op *Op) int {
+		if d, ok := depths[op.Digest]; ok {
+			return d
+		}
+		d := 0
+		for _, in := range op.Op.Inputs {
+			if input, ok := byDigest[in.Digest]; ok {
+				if di := depth(input); di > d {
+					d = di
+				}
+			}
+		}
+		if op.Op.Op != nil {
+			d++
+		}
+		depths[op.Digest] = d
+		return d
+	}
+
+	widths := map[int]int{}
+	images, sources, caps := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for i := range ops {
+		op := &ops[i]
+		for c, on := range op.OpMetadata.Caps {
+			if on {
+				caps[string(c)] = true
+			}
+		}
+		switch o := op.Op.Op.(type) {
+		case nil:
+			continue
+		case *pb.Op_Source:
+			m.Ops["source"]++
+			id := o.Source.Identifier
+			sources[id] = true
+			if strings.HasPrefix(id, "docker-image://") {
+				images[strings.TrimPrefix(id, "docker-image://")] = true
+			}
+		case *pb.Op_Exec:
+			m.Ops["exec"]++
+		case *pb.Op_File:
+			m.Ops["file"]++
+		case *pb.Op_Build:
+			m.Ops["build"]++
+		}
+		m.Total++
+		d := depth(op)
+		widths[d]++
+		if d > m.Depth {
+			m.Depth = d
+		}
+		if widths[d] > m.Width {
+			m.Width = widths[d]
+		}
+	}
+	if m.Depth > 0 {
+		m.Parallelism = float64(m.Total) / float64(m.Depth)
+	}
+	m.Images, m.Sources, m.Caps = keys(images), keys(sources), keys(caps)
+	return m
+}
+
+func keys(set map[string]bool) []string {
+	ks := []string{}
+	for k := range set {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
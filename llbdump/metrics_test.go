@@ -0,0 +1,40 @@
+package llbdump
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMeasure(t *testing.T) {
+	dt := []byte("FROM golang:1.12 AS build\nRUN go build -o /app\nFROM alpine\nCOPY --from=build /app /app\n")
+	def, err := Convert(dt, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops, err := Ops(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := Measure(ops)
+	if want := map[string]int{"source": 2, "exec": 1, "file": 1}; !reflect.DeepEqual(m.Ops, want) {
+		t.Errorf("ops %v, want %v", m.Ops, want)
+	}
+	// golang, its RUN and the COPY of its output are on the critical
+	// path; the two images are pulled at once
+	if m.Total != 4 || m.Depth != 3 || m.Width != 2 {
+		t.Errorf("total %d depth %d width %d, want 4, 3 and 2", m.Total, m.Depth, m.Width)
+	}
+	if want := []string{"docker.io/library/alpine:latest", "docker.io/library/golang:1.12"}; !reflect.DeepEqual(m.Images, want) {
+		t.Errorf("images %v, want %v", m.Images, want)
+	}
+	if m.Parallelism != 4.0/3 {
+		t.Errorf("parallelism %v, want 4/3", m.Parallelism)
+	}
+}
+
+func TestMeasureEmpty(t *testing.T) {
+	m := Measure(nil)
+	if m.Total != 0 || m.Depth != 0 || m.Parallelism != 0 || len(m.Images) != 0 {
+		t.Errorf("metrics %+v, want none", m)
+	}
+}
@@ -0,0 +1,119 @@
+package llbdump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/btwiuse/buildahfy/stats"
+)
+
+// Report aggregates the metrics of the LLB graphs of a corpus.
+type Report struct {
+	Files  int `json:"files"`
+	Failed int `json:"failed"`
+	// Ops counts the vertices of all graphs by type.
+	Ops map[string]int `json:"ops"`
+	// Images counts files by the images they build from, and Caps by the
+	// capabilities they request.
+	Images map[string]int `json:"images"`
+	Caps   map[string]int `json:"caps"`
+	// Parallelism is the vertices of all graphs over the sum of their
+	// depths: how much faster BuildKit could solve the corpus than one
+	// vertex at a time, as a buildah script runs.
+	Parallelism float64 `json:"parallelism"`
+
+	total, depths       int
+	sizes, depth, width []int
+	distinct            []int
+}
+
+func NewReport() *Report {
+	return &Report{Ops: map[string]int{}, Images: map[string]int{}, Caps: map[string]int{}}
+}
+
+// Add counts one file; nil metrics count as a file that did not convert.
+func (rep *Report) Add(m *Metrics) {
+	rep.Files++
+	if m == nil {
+		rep.Failed++
+		return
+	}
+	for typ, n := range m.Ops {
+		rep.Ops[typ] += n
+	}
+	for _, image := range m.Images {
+		rep.Images[image]++
+	}
+	for _, c := range m.Caps {
+		rep.Caps[c]++
+	}
+	rep.total += m.Total
+	rep.depths += m.Depth
+	if rep.depths > 0 {
+		rep.Parallelism = float64(rep.total) / float64(rep.depths)
+	}
+	rep.sizes = append(rep.sizes, m.Total)
+	rep.depth = append(rep.depth, m.Depth)
+	rep.width = append(rep.width, m.Width)
+	rep.distinct = append(rep.distinct, len(m.Images))
+}
+
+func (rep *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		*Report
+		Vertices stats.Percentiles `json:"vertices"`
+		Depth    stats.Percentiles `json:"depth"`
+		Width    stats.Percentiles `json:"width"`
+		Bases    stats.Percentiles `json:"bases"`
+	}{rep, stats.PercentilesOf(rep.sizes), stats.PercentilesOf(rep.depth), stats.PercentilesOf(rep.width), stats.PercentilesOf(rep.distinct)})
+}
+
+func (rep *Report) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "%d files, %d not converted to LLB\n", rep.Files, rep.Failed)
+	fmt.Fprintf(w, "%d vertices, %d on critical paths: parallelism %.2f\n", rep.total, rep.depths, rep.Parallelism)
+
+	fmt.Fprintf(w, "\n%-32s %10s\n", "op", "vertices")
+	for _, typ := range sortedByCount(rep.Ops) {
+		fmt.Fprintf(w, "%-32s %10d\n", typ, rep.Ops[typ])
+	}
+	fmt.Fprintf(w, "\n%-32s %8s %8s %8s %8s\n", "percentiles", "p50", "p90", "p99", "max")
+	for _, d := range []struct {
+		name   string
+		values []int
+	}{
+		{"vertices", rep.sizes},
+		{"depth", rep.depth},
+		{"width", rep.width},
+		{"distinct base images", rep.distinct},
+	} {
+		p := stats.PercentilesOf(d.values)
+		fmt.Fprintf(w, "%-32s %8d %8d %8d %8d\n", d.name, p.P50, p.P90, p.P99, p.Max)
+	}
+	fmt.Fprintf(w, "\n%-40s %10s\n", "llb capability", "files")
+	for _, c := range sortedByCount(rep.Caps) {
+		fmt.Fprintf(w, "%-40s %10d\n", c, rep.Caps[c])
+	}
+	fmt.Fprintf(w, "\n%-40s %10s\n", "base image", "files")
+	for _, image := range sortedByCount(rep.Images) {
+		fmt.Fprintf(w, "%-40s %10d\n", image, rep.Images[image])
+	}
+	return nil
+}
+
+func sortedByCount(counts map[string]int) []string {
+	keys := []string{}
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"runtime"
+
+	"github.com/btwiuse/buildahfy/corpus"
+	"github.com/btwiuse/buildahfy/llbdump"
+)
+
+// llbStatsMain converts every record of the corpus to LLB and reports
+// the shape of the graphs.
+func llbStatsMain(args []string) {
+	opt := llbdump.Options{BuildArgs: kvFlag{}}
+	format, jobs := "", 0
+	fs := flag.NewFlagSet("llb-stats", flag.ExitOnError)
+	fs.StringVar(&format, "format", "text", "output format: text or json for a summary, or ndjson for the metrics of each record")
+	fs.Var(kvFlag(opt.BuildArgs), "build-arg", "build-time variable `key=value`")
+	fs.IntVar(&jobs, "j", runtime.NumCPU(), "number of records to process in parallel")
+	path := addStoreFlag(fs)
+	in := addInputFlags(fs)
+	fs.Parse(args)
+	checkFormat(format, "text", "json", "ndjson")
+
+	type record struct {
+		Id string `json:"id"`
+		*llbdump.Metrics
+		Error string `json:"error,omitempty"`
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	rep := llbdump.NewReport()
+	st := openStore(*path)
+	defer st.Close()
+	measure := func(rec *corpus.Record) interface{} {
+		r := &record{}
+		loadStored(st, bucket("llb-stats", buildArgsOption(opt.BuildArgs)...), rec, r, func() error {
+			def, err := llbdump.Convert([]byte(rec.Contents), opt)
+			if err != nil {
+				r.Error = err.Error()
+				return nil
+			}
+			ops, err := llbdump.Ops(def)
+			if err != nil {
+				r.Error = err.Error()
+				return nil
+			}
+			r.Metrics = llbdump.Measure(ops)
+			return nil
+		})
+		r.Id = rec.Id
+		return r
+	}
+	emit := func(rec *corpus.Record, res interface{}) error {
+		r := res.(*record)
+		if format == "ndjson" {
+			return enc.Encode(r)
+		}
+		rep.Add(r.Metrics)
+		return nil
+	}
+	if err := in.mapRecords(nil, jobs, measure, emit); err != nil {
+		mapFailed(err)
+	}
+
+	var err error
+	switch format {
+	case "text":
+		err = rep.WriteText(os.Stdout)
+	case "json":
+		err = rep.WriteJSON(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,49 @@
+package parserdiff
+
+import (
+	"strings"
+)
+
+// Minimize removes lines from dt for as long as the parsers still
+// disagree in the same way (see Diff.Same), and returns what is left. It is delta
+// debugging over lines, so the result is small but not necessarily the
+// smallest.
+func Minimize(dt []byte, d *Diff) []byte {
+	lines := strings.SplitAfter(string(dt), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	fails := func(lines []string) bool {
+		return d.Same(Compare([]byte(strings.Join(lines, ""))))
+	}
+	n := 2
+	for len(lines) >= 2 {
+		chunk := (len(lines) + n - 1) / n
+		reduced := false
+		for start := 0; start < len(lines); start += chunk {
+			end := start + chunk
+			if end > len(lines) {
+				end = len(lines)
+			}
+			candidate := append(append([]string{}, lines[:start]...), lines[end:]...)
+			if fails(candidate) {
+				lines = candidate
+				if n > 2 {
+					n--
+				}
+				reduced = true
+				break
+			}
+		}
+		if reduced {
+			continue
+		}
+		if n >= len(lines) {
+			break
+		}
+		if n *= 2; n > len(lines) {
+			n = len(lines)
+		}
+	}
+	return []byte(strings.Join(lines, ""))
+}
@@ -0,0 +1,27 @@
+package parserdiff
+
+import (
+	"testing"
+)
+
+func TestMinimize(t *testing.T) {
+	for _, tc := range []struct {
+		name, in, want string
+	}{
+		// RUN y alone fails buildkit too, but for want of a stage,
+		// which is another disagreement
+		{"unknown instruction", "FROM alpine\nFOO bar\nRUN x\nRUN y\n", "FOO bar\n"},
+	} {
+		d := Compare([]byte(tc.in))
+		if d == nil {
+			t.Fatalf("%s: the parsers agree", tc.name)
+		}
+		got := Minimize([]byte(tc.in), d)
+		if string(got) != tc.want {
+			t.Errorf("%s: minimized to %q, want %q", tc.name, got, tc.want)
+		}
+		if !d.Same(Compare(got)) {
+			t.Errorf("%s: minimized to another disagreement: %+v", tc.name, Compare(got))
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package parserdiff runs the asottile/dockerfile and buildkit parsers on
+// the same Dockerfile and reports where they disagree.
+package parserdiff
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/asottile/dockerfile"
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// Command is an instruction in the shape of dockerfile.Command, which
+// the buildkit parse tree is flattened into for comparison.
+type Command struct {
+	Cmd       string
+	SubCmd    string
+	Json      bool
+	Flags     []string
+	Value     []string
+	StartLine int
+	EndLine   int
+}
+
+func (c Command) String() string {
+	s := c.Cmd
+	if c.SubCmd != "" {
+		s += " " + c.SubCmd
+	}
+	return fmt.Sprintf("%s flags=%q json=%t value=%q lines=%d-%d", strings.ToUpper(s), c.Flags, c.Json, c.Value, c.StartLine, c.EndLine)
+}
+
+// Result is what one parser made of a Dockerfile.
+type Result struct {
+	Commands []Command
+	Err      error
+}
+
+func (r Result) String() string {
+	if r.Err != nil {
+		return "error: " + r.Err.Error()
+	}
+	return fmt.Sprintf("ok, %d instructions", len(r.Commands))
+}
+
+// Alt parses with asottile/dockerfile.
+func Alt(dt []byte) (res Result) {
+	defer recoverInto(&res)
+	cmds, err := dockerfile.ParseReader(bytes.NewReader(dt))
+	if err != nil {
+		return Result{Err: err}
+	}
+	for _, c := range cmds {
+		res.Commands = append(res.Commands, Command{
+			Cmd:       strings.ToLower(c.Cmd),
+			SubCmd:    strings.ToLower(c.SubCmd),
+			Json:      c.Json,
+			Flags:     c.Flags,
+			Value:     c.Value,
+			StartLine: c.StartLine,
+			EndLine:   c.EndLine,
+		})
+	}
+	return res
+}
+
+// BuildKit parses with the buildkit parser and checks the result with
+// the instructions package, as dockerfile2llb would.
+func BuildKit(dt []byte) (res Result) {
+	defer recoverInto(&res)
+	ast, err := parser.Parse(bytes.NewReader(dt))
+	if err != nil {
+		return Result{Err: err}
+	}
+	if _, _, err := instructions.Parse(ast.AST); err != nil {
+		return Result{Err: err}
+	}
+	for _, n := range ast.AST.Children {
+		c := Command{Cmd: n.Value, Flags: n.Flags, StartLine: n.StartLine, EndLine: n.EndLine}
+		if n.Next != nil && len(n.Next.Children) > 0 {
+			n = n.Next.Children[0]
+			c.SubCmd = n.Value
+		}
+		c.Json = n.Attributes["json"]
+		for a := n.Next; a != nil; a = a.Next {
+			c.Value = append(c.Value, a.Value)
+		}
+		res.Commands = append(res.Commands, c)
+	}
+	return res
+}
+
+func recoverInto(res *Result) {
+	if r := recover(); r != nil {
+		*res = Result{Err: fmt.Errorf("panic: %v", r)}
+	}
+}
+
+// Diff is a disagreement between the parsers.
+type Diff struct {
+	// Kind is what they disagree on: outcome, count, cmd, flags, json,
+	// value or lines.
+	Kind string
+	// Line is the first line of the instruction they disagree on, or 0.
+	Line     int
+	Alt      string
+	BuildKit string
+
+	// errors are the errors of the parsers, and instruction the commands
+	// they disagree on, which a smaller Dockerfile must keep to disagree
+	// in the same way.
+	errors      string
+	instruction string
+}
+
+// Same reports whether o is the same disagreement as d: of the same
+// kind, and on the same instructions or with the same errors, line
+// numbers aside.
+func (d *Diff) Same(o *Diff) bool {
+	return o != nil && o.Kind == d.Kind && o.instruction == d.instruction && o.errors == d.errors
+}
+
+var digits = regexp.MustCompile(`[0-9]+`)
+
+// errorText returns the errors of the results without line numbers.
+func errorText(alt, bk Result) string {
+	text := ""
+	for _, r := range []Result{alt, bk} {
+		if r.Err != nil {
+			text += digits.ReplaceAllString(r.Err.Error(), "N")
+		}
+		text += "\n"
+	}
+	return text
+}
+
+// Compare parses dt with both parsers and returns their first
+// disagreement, or nil if they agree.
+func Compare(dt []byte) *Diff {
+	alt, bk := Alt(dt), BuildKit(dt)
+	if (alt.Err == nil) != (bk.Err == nil) {
+		return &Diff{Kind: "outcome", Alt: alt.String(), BuildKit: bk.String(), errors: errorText(alt, bk)}
+	}
+	if alt.Err != nil {
+		return nil
+	}
+	for i := 0; i < len(alt.Commands) && i < len(bk.Commands); i++ {
+		a, b := alt.Commands[i], bk.Commands[i]
+		kind := ""
+		switch {
+		case a.Cmd != b.Cmd || a.SubCmd != b.SubCmd:
+			kind = "cmd"
+		case !equal(a.Flags, b.Flags):
+			kind = "flags"
+		case a.Json != b.Json:
+			kind = "json"
+		case !equal(a.Value, b.Value):
+			kind = "value"
+		case a.StartLine != b.StartLine || a.EndLine != b.EndLine:
+			kind = "lines"
+		default:
+			continue
+		}
+		return &Diff{Kind: kind, Line: b.StartLine, Alt: a.String(), BuildKit: b.String(), instruction: a.Cmd + " " + b.Cmd}
+	}
+	if len(alt.Commands) != len(bk.Commands) {
+		return &Diff{Kind: "count", Alt: alt.String(), BuildKit: bk.String()}
+	}
+	return nil
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
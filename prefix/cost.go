@@ -0,0 +1,136 @@
+package prefix
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/btwiuse/buildahfy/step"
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+)
+
+// The cost model is deliberately rough: a Dockerfile does not say how
+// long its commands run or how much they write, so RUN instructions are
+// charged a fixed amount plus an amount per package they install or file
+// they download. Other instructions only change the image config and
+// cost nothing.
+const (
+	runSeconds      = 5
+	runBytes        = 10 << 20
+	packageSeconds  = 3
+	packageBytes    = 15 << 20
+	updateSeconds   = 10
+	updateBytes     = 40 << 20
+	downloadSeconds = 5
+	downloadBytes   = 20 << 20
+)
+
+// installers are the package managers whose install subcommand is
+// followed by package names.
+var installers = map[string]string{
+	"apt-get":  "install",
+	"apt":      "install",
+	"yum":      "install",
+	"dnf":      "install",
+	"microdnf": "install",
+	"zypper":   "install",
+	"apk":      "add",
+	"pip":      "install",
+	"pip3":     "install",
+	"npm":      "install",
+	"gem":      "install",
+}
+
+// Cost is the estimated time and disk space to build some instructions
+// once.
+type Cost struct {
+	Seconds float64 `json:"seconds"`
+	Bytes   int64   `json:"bytes"`
+}
+
+func (c Cost) Add(d Cost) Cost {
+	return Cost{Seconds: c.Seconds + d.Seconds, Bytes: c.Bytes + d.Bytes}
+}
+
+// Times returns the cost of building n times.
+func (c Cost) Times(n int) Cost {
+	return Cost{Seconds: c.Seconds * float64(n), Bytes: c.Bytes * int64(n)}
+}
+
+func (c Cost) String() string {
+	d := time.Duration(c.Seconds) * time.Second
+	return fmt.Sprintf("%s and %s", d, size(c.Bytes))
+}
+
+func size(n int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	f, i := float64(n), 0
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", f, units[i])
+}
+
+// Estimate returns the cost of building a single step.
+func Estimate(s step.Step) Cost {
+	run, ok := s.Instruction.(*instructions.RunCommand)
+	if !ok {
+		return Cost{}
+	}
+	c := Cost{Seconds: runSeconds, Bytes: runBytes}
+	words := []string{}
+	for _, arg := range run.CmdLine {
+		words = append(words, strings.Fields(arg)...)
+	}
+	for i, w := range words {
+		switch w {
+		case "update", "makecache":
+			if i == 0 {
+				break
+			}
+			if _, ok := installers[words[i-1]]; ok {
+				c = c.Add(Cost{Seconds: updateSeconds, Bytes: updateBytes})
+			}
+		case "curl", "wget":
+			c = c.Add(Cost{Seconds: downloadSeconds, Bytes: downloadBytes})
+		}
+	}
+	n := packages(words)
+	return c.Add(Cost{Seconds: packageSeconds, Bytes: packageBytes}.Times(n))
+}
+
+// packages counts the package names given to install subcommands of
+// known package managers in a shell command split into words.
+func packages(words []string) int {
+	n := 0
+	for i := 1; i < len(words); i++ {
+		sub, ok := installers[words[i-1]]
+		if !ok || words[i] != sub {
+			continue
+		}
+		for _, w := range words[i+1:] {
+			if separator(w) {
+				break
+			}
+			if !strings.HasPrefix(w, "-") {
+				n++
+			}
+			if strings.HasSuffix(w, ";") {
+				break
+			}
+		}
+	}
+	return n
+}
+
+func separator(w string) bool {
+	switch w {
+	case "&&", "||", ";", "|", "\\", "&":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,247 @@
+package prefix
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Prefix is a run of instructions that several stages start with, and
+// the base image proposed to build it once.
+type Prefix struct {
+	// Image is the name proposed for the base image.
+	Image        string   `json:"image"`
+	Instructions []string `json:"instructions"`
+	Members      []Member `json:"members"`
+	// Cost is the estimate for building the prefix once, and Duplicated
+	// for building it once per member beyond the first.
+	Cost       Cost `json:"cost"`
+	Duplicated Cost `json:"duplicated"`
+	// Base is the proposed Dockerfile of the base image.
+	Base string `json:"base"`
+
+	length int
+	stages []*Stage
+}
+
+// Member is a stage starting with a prefix.
+type Member struct {
+	Id    string `json:"id"`
+	Stage int    `json:"stage"`
+	Name  string `json:"name,omitempty"`
+}
+
+type node struct {
+	children map[string]*node
+	stages   []*Stage
+}
+
+// Report holds the files of a corpus and the prefixes mined from them.
+type Report struct {
+	Files  int `json:"files"`
+	Failed int `json:"failed"`
+	Stages int `json:"stages"`
+	// Duplicated sums the duplicated cost of all prefixes.
+	Duplicated Cost      `json:"duplicated"`
+	Prefixes   []*Prefix `json:"prefixes"`
+
+	files []*File
+	root  *node
+}
+
+func NewReport() *Report {
+	return &Report{Prefixes: []*Prefix{}, root: &node{children: map[string]*node{}}}
+}
+
+// Add adds one file; a nil file counts as one that failed to parse.
+func (rep *Report) Add(f *File) {
+	rep.Files++
+	if f == nil {
+		rep.Failed++
+		return
+	}
+	rep.files = append(rep.files, f)
+	for _, s := range f.Stages {
+		rep.Stages++
+		n := rep.root
+		for _, k := range s.Keys {
+			child, ok := n.children[k]
+			if !ok {
+				child = &node{children: map[string]*node{}}
+				n.children[k] = child
+			}
+			child.stages = append(child.stages, s)
+			n = child
+		}
+	}
+}
+
+// Mine finds the prefixes of at least minLength instructions, counting
+// the FROM, that at least minStages stages start with, and names their
+// base images image-1, image-2, ... in order of the cost they duplicate.
+// Each stage is given to at most one prefix: the prefixes are taken
+// greedily, most duplicated cost first, and one that is left with fewer
+// than minStages stages of its own is dropped.
+func (rep *Report) Mine(image string, minStages, minLength int) {
+	candidates := []*Prefix{}
+	var walk func(n *node, depth int)
+	walk = func(n *node, depth int) {
+		keys := []string{}
+		for k := range n.children {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		maximal := true
+		for _, k := range keys {
+			child := n.children[k]
+			if len(child.stages) == len(n.stages) {
+				maximal = false
+			}
+			if len(child.stages) >= minStages {
+				walk(child, depth+1)
+			}
+		}
+		if maximal && depth >= minLength && len(n.stages) >= minStages {
+			candidates = append(candidates, newPrefix(n.stages, depth))
+		}
+	}
+	walk(rep.root, 0)
+	sortPrefixes(candidates)
+
+	taken := map[*Stage]bool{}
+	rep.Prefixes = []*Prefix{}
+	for _, c := range candidates {
+		stages := []*Stage{}
+		for _, s := range c.stages {
+			if !taken[s] {
+				stages = append(stages, s)
+			}
+		}
+		if len(stages) < minStages {
+			continue
+		}
+		p := newPrefix(stages, c.length)
+		if p.Cost.Seconds == 0 && p.Cost.Bytes == 0 {
+			continue
+		}
+		for _, s := range stages {
+			taken[s] = true
+		}
+		rep.Prefixes = append(rep.Prefixes, p)
+	}
+	sortPrefixes(rep.Prefixes)
+	rep.Duplicated = Cost{}
+	for i, p := range rep.Prefixes {
+		p.Image = fmt.Sprintf("%s-%d", image, i+1)
+		rep.Duplicated = rep.Duplicated.Add(p.Duplicated)
+	}
+}
+
+func newPrefix(stages []*Stage, length int) *Prefix {
+	first := stages[0]
+	steps := first.Steps[:length]
+	p := &Prefix{length: length, stages: stages}
+	for _, s := range steps {
+		p.Instructions = append(p.Instructions, s.Source())
+		p.Cost = p.Cost.Add(Estimate(s))
+	}
+	for _, s := range stages {
+		p.Members = append(p.Members, Member{Id: s.File.Id, Stage: s.Index, Name: s.Name})
+	}
+	p.Duplicated = p.Cost.Times(len(stages) - 1)
+
+	// the base starts with the directives and the FROM of the resolved
+	// reference, which every member shares, without the ARGs of any one
+	// of them
+	lines := []string{first.Keys[0]}
+	if len(steps) > 1 {
+		lines = append(lines, first.File.source(steps[1:])...)
+	}
+	p.Base = strings.Join(lines, "\n") + "\n"
+	return p
+}
+
+func sortPrefixes(ps []*Prefix) {
+	sort.SliceStable(ps, func(i, j int) bool {
+		a, b := ps[i].Duplicated, ps[j].Duplicated
+		if a.Seconds != b.Seconds {
+			return a.Seconds > b.Seconds
+		}
+		return a.Bytes > b.Bytes
+	})
+}
+
+// Child is a Dockerfile rewritten to start FROM the proposed base images.
+type Child struct {
+	Id         string `json:"id"`
+	Dockerfile string `json:"dockerfile"`
+}
+
+// Children rewrites every file with a stage in one of the mined
+// prefixes, replacing the lines of each prefix with a FROM of its base
+// image. Files come in the order they were added.
+func (rep *Report) Children() []Child {
+	type replacement struct {
+		first, last int
+		from        string
+	}
+	byFile := map[*File][]replacement{}
+	for _, p := range rep.Prefixes {
+		for _, s := range p.stages {
+			steps := s.Steps[:p.length]
+			from := "FROM " + p.Image
+			if s.Name != "" {
+				from += " AS " + s.Name
+			}
+			byFile[s.File] = append(byFile[s.File], replacement{
+				first: steps[0].Node.StartLine,
+				last:  steps[len(steps)-1].Node.EndLine,
+				from:  from,
+			})
+		}
+	}
+	children := []Child{}
+	for _, f := range rep.files {
+		rs, ok := byFile[f]
+		if !ok {
+			continue
+		}
+		// replace from the bottom up so earlier line numbers hold
+		sort.Slice(rs, func(i, j int) bool { return rs[i].first > rs[j].first })
+		lines := append([]string{}, f.lines...)
+		for _, r := range rs {
+			lines = append(lines[:r.first-1], append([]string{r.from}, lines[r.last:]...)...)
+		}
+		children = append(children, Child{Id: f.Id, Dockerfile: strings.Join(lines, "\n")})
+	}
+	return children
+}
+
+func (rep *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rep)
+}
+
+func (rep *Report) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "%d files, %d failed to parse, %d stages\n", rep.Files, rep.Failed, rep.Stages)
+	fmt.Fprintf(w, "%d shared prefixes duplicate an estimated %s\n", len(rep.Prefixes), rep.Duplicated)
+	for _, p := range rep.Prefixes {
+		fmt.Fprintf(w, "\n%s: %d stages share %d instructions, costing %s each, %s duplicated\n",
+			p.Image, len(p.Members), len(p.Instructions), p.Cost, p.Duplicated)
+		for _, line := range strings.Split(strings.TrimSuffix(p.Base, "\n"), "\n") {
+			fmt.Fprintf(w, "  | %s\n", line)
+		}
+		for _, m := range p.Members {
+			if m.Name != "" {
+				fmt.Fprintf(w, "  %s (stage %d, %s)\n", m.Id, m.Stage, m.Name)
+				continue
+			}
+			fmt.Fprintf(w, "  %s (stage %d)\n", m.Id, m.Stage)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// Package prefix finds the instructions that stages across a corpus
+// start with in common, estimates the build time and storage spent on
+// building them again and again, and proposes shared base images that
+// the stages could start FROM instead.
+package prefix
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/bases"
+	"github.com/btwiuse/buildahfy/format"
+	"github.com/btwiuse/buildahfy/step"
+	"github.com/moby/buildkit/frontend/dockerfile/dockerfile2llb"
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+var utf8bom = []byte{0xEF, 0xBB, 0xBF}
+
+// File is a parsed Dockerfile.
+type File struct {
+	Id     string
+	Meta   []step.Step
+	Stages []*Stage
+
+	lines []string
+}
+
+// Stage is a stage of a File, cut short at the first instruction that
+// cannot move into a base image.
+type Stage struct {
+	File *File
+	// Index counts the stages of the file from 0.
+	Index int
+	Name  string
+	Steps []step.Step
+	// Keys are the steps normalized for comparison. That of the FROM
+	// starts with the parser directives, which the other steps are read
+	// with.
+	Keys []string
+}
+
+// Parse parses a Dockerfile into its stages. Stages built on an earlier
+// stage of the same file are left out, as they share nothing with other
+// files, and so are stages whose base needs an ARG without a default.
+func Parse(id string, r io.Reader) (*File, error) {
+	dt, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	res, err := parser.Parse(bytes.NewReader(dt))
+	if err != nil {
+		return nil, err
+	}
+	return ParseResult(id, dt, res)
+}
+
+// ParseResult is Parse for a Dockerfile dt already parsed into res.
+func ParseResult(id string, dt []byte, res *parser.Result) (*File, error) {
+	steps, err := step.FromAST(res.AST)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{
+		Id:    id,
+		lines: strings.Split(string(bytes.TrimPrefix(dt, utf8bom)), "\n"),
+	}
+	meta, stages := step.Stages(steps)
+	f.Meta = meta
+	args := bases.NewArgs(meta, res.EscapeToken, nil)
+	header := directives(dt, res.EscapeToken)
+	names := map[string]bool{}
+	for i, steps := range stages {
+		from := steps[0].Instruction.(*instructions.Stage)
+		base, err := args.Expand(from.BaseName)
+		names[strconv.Itoa(i)] = true
+		if err != nil || !args.Known(from.BaseName) || names[strings.ToLower(base)] {
+			names[from.Name] = true
+			continue
+		}
+		names[from.Name] = true
+		s := &Stage{File: f, Index: i, Name: from.Name}
+		s.Steps, s.Keys = steps[:1], []string{strings.Join(append(header, fromKey(from, base)), "\n")}
+		for _, st := range steps[1:] {
+			if !movable(st) {
+				break
+			}
+			s.Steps = append(s.Steps, st)
+			s.Keys = append(s.Keys, key(st))
+		}
+		f.Stages = append(f.Stages, s)
+	}
+	return f, nil
+}
+
+// directives returns the parser directives of dt that change how it
+// builds, as lines: the escape, first so that parsers reading only the
+// escape see it, and the syntax.
+func directives(dt []byte, escape rune) []string {
+	lines := []string{}
+	if escape != parser.DefaultEscapeToken {
+		lines = append(lines, "# escape="+string(escape))
+	}
+	if syntax, ok := dockerfile2llb.ParseDirectives(bytes.NewReader(dt))["syntax"]; ok {
+		lines = append(lines, "# syntax="+syntax)
+	}
+	return lines
+}
+
+// movable reports whether a step would build the same in a base image.
+// COPY, ADD and RUN --mount read the build context or other stages,
+// which a base image does not have. An ARG would not reach the build of
+// the child, and ending the prefix there also keeps out every step that
+// uses it; an ONBUILD would fire in every child built on the base.
+func movable(s step.Step) bool {
+	switch s.Instruction.(type) {
+	case *instructions.CopyCommand, *instructions.AddCommand:
+		return false
+	case *instructions.ArgCommand, *instructions.OnbuildCommand:
+		return false
+	case *instructions.RunCommand:
+		for _, flag := range s.Node.Flags {
+			if strings.HasPrefix(flag, "--mount") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// fromKey normalizes a FROM by its resolved base, without the stage
+// name, which is the children's to give.
+func fromKey(from *instructions.Stage, base string) string {
+	if from.Platform != "" {
+		return "FROM --platform=" + from.Platform + " " + base
+	}
+	return "FROM " + base
+}
+
+// key normalizes a step other than FROM so that the same instruction
+// written with different spacing or keyword case compares equal. Blanks
+// are only collapsed outside quotes in shell commands, where they do not
+// change what runs.
+func key(s step.Step) string {
+	cmd, json := s.Node.Value, s.Node.Attributes["json"]
+	words := []string{strings.ToUpper(cmd)}
+	words = append(words, s.Node.Flags...)
+	for i, a := 0, s.Node.Next; a != nil; i, a = i+1, a.Next {
+		value := format.Argument(cmd, i, a.Value)
+		if format.Shell(cmd, i, json) {
+			value = format.Squeeze(value)
+		}
+		words = append(words, strconv.Quote(value))
+	}
+	return strings.Join(words, " ")
+}
+
+// source returns the lines of the file from the first to the last step.
+func (f *File) source(steps []step.Step) []string {
+	first, last := steps[0].Node.StartLine, steps[len(steps)-1].Node.EndLine
+	lines := []string{}
+	for _, line := range f.lines[first-1 : last] {
+		lines = append(lines, strings.TrimRight(line, "\r"))
+	}
+	return lines
+}
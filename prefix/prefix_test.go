@@ -0,0 +1,168 @@
+package prefix
+
+import (
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, id, dockerfile string) *File {
+	f, err := Parse(id, strings.NewReader(dockerfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func mine(t *testing.T, files map[string]string, ids ...string) *Report {
+	rep := NewReport()
+	for _, id := range ids {
+		rep.Add(parse(t, id, files[id]))
+	}
+	rep.Mine("base", 2, 2)
+	return rep
+}
+
+func TestParseStopsAtUnmovable(t *testing.T) {
+	for _, tc := range []struct {
+		name, dockerfile string
+		keys             int
+	}{
+		{"copy", "FROM a\nRUN apk add x\nCOPY . .\nRUN make\n", 2},
+		{"arg", "FROM a\nRUN apk add x\nARG V\nRUN echo $V\n", 2},
+		{"onbuild", "FROM a\nRUN apk add x\nONBUILD RUN make\nRUN y\n", 2},
+		{"env", "FROM a\nENV X=1\nRUN apk add x\n", 3},
+	} {
+		f := parse(t, tc.name, tc.dockerfile)
+		if len(f.Stages) != 1 || len(f.Stages[0].Keys) != tc.keys {
+			t.Errorf("%s: got keys %q, want %d", tc.name, f.Stages[0].Keys, tc.keys)
+		}
+	}
+}
+
+func TestParseResolvesMetaArgs(t *testing.T) {
+	f := parse(t, "a", "ARG V=3.8\nARG IMAGE=python:${V}\nFROM ${IMAGE} AS build\nRUN pip install x\n")
+	if got := f.Stages[0].Keys[0]; got != "FROM python:3.8" {
+		t.Errorf("got %q", got)
+	}
+	f = parse(t, "b", "ARG V\nFROM python:${V}\nRUN pip install x\n")
+	if len(f.Stages) != 0 {
+		t.Errorf("a base needing a build arg was kept: %q", f.Stages[0].Keys)
+	}
+	f = parse(t, "c", "FROM alpine AS build\nFROM BUILD\nRUN x\n")
+	if len(f.Stages) != 1 {
+		t.Errorf("got %d stages, want the one not built on an earlier stage", len(f.Stages))
+	}
+}
+
+func TestMineKeysOnResolvedBase(t *testing.T) {
+	files := map[string]string{
+		"a": "ARG V=3.8\nFROM python:${V}\nRUN pip install flask\nCOPY . .\n",
+		"b": "ARG V=3.8\nFROM python:${V} AS app\nRUN pip install flask\nCOPY . .\n",
+		"c": "ARG V=3.12\nFROM python:${V}\nRUN pip install flask\nCOPY . .\n",
+		"d": "FROM python:3.12\nRUN pip install flask\n",
+	}
+	rep := mine(t, files, "a", "b", "c", "d")
+	if len(rep.Prefixes) != 2 {
+		t.Fatalf("got %d prefixes, want one per python version", len(rep.Prefixes))
+	}
+	bases := map[string][]string{}
+	for _, p := range rep.Prefixes {
+		ids := []string{}
+		for _, m := range p.Members {
+			ids = append(ids, m.Id)
+		}
+		bases[p.Base] = ids
+	}
+	for base, want := range map[string]string{
+		"FROM python:3.8\nRUN pip install flask\n":  "a b",
+		"FROM python:3.12\nRUN pip install flask\n": "c d",
+	} {
+		if got := strings.Join(bases[base], " "); got != want {
+			t.Errorf("members of %q: got %q, want %q", base, got, want)
+		}
+	}
+
+	children := map[string]string{}
+	for _, c := range rep.Children() {
+		children[c.Id] = c.Dockerfile
+	}
+	image := map[string]string{}
+	for _, p := range rep.Prefixes {
+		image[strings.SplitN(p.Base, "\n", 2)[0]] = p.Image
+	}
+	if want := "ARG V=3.8\nFROM " + image["FROM python:3.8"] + " AS app\nCOPY . .\n"; children["b"] != want {
+		t.Errorf("child b: got %q, want %q", children["b"], want)
+	}
+	if want := "ARG V=3.12\nFROM " + image["FROM python:3.12"] + "\nCOPY . .\n"; children["c"] != want {
+		t.Errorf("child c: got %q, want %q", children["c"], want)
+	}
+}
+
+func TestMineMinimums(t *testing.T) {
+	files := map[string]string{
+		"a": "FROM alpine\nRUN apk add curl\nRUN apk add git\n",
+		"b": "FROM alpine\nRUN apk add curl\nRUN apk add make\n",
+		"c": "FROM debian\nRUN apt-get update\n",
+	}
+	rep := mine(t, files, "a", "b", "c")
+	if len(rep.Prefixes) != 1 {
+		t.Fatalf("got %d prefixes, want 1", len(rep.Prefixes))
+	}
+	p := rep.Prefixes[0]
+	if p.Image != "base-1" || len(p.Instructions) != 2 || len(p.Members) != 2 {
+		t.Errorf("got %s with %q shared by %d", p.Image, p.Instructions, len(p.Members))
+	}
+	if p.Duplicated != p.Cost {
+		t.Errorf("duplicated %v, want the cost of one extra build %v", p.Duplicated, p.Cost)
+	}
+	if rep.Files != 3 || rep.Stages != 3 {
+		t.Errorf("counted %d files and %d stages", rep.Files, rep.Stages)
+	}
+}
+
+func TestMineKeepsQuotedBlanks(t *testing.T) {
+	files := map[string]string{
+		"a": "FROM alpine\nRUN echo \"a  b\" >/x\n",
+		"b": "FROM alpine\nRUN echo \"a b\" >/x\n",
+		"c": "FROM alpine\nRUN   echo \"a  b\"   >/x\n",
+	}
+	rep := mine(t, files, "a", "b", "c")
+	if len(rep.Prefixes) != 1 {
+		t.Fatalf("got %d prefixes, want 1", len(rep.Prefixes))
+	}
+	members := []string{}
+	for _, m := range rep.Prefixes[0].Members {
+		members = append(members, m.Id)
+	}
+	if got := strings.Join(members, " "); got != "a c" {
+		t.Errorf("members %q, want a and c, whose commands run alike", got)
+	}
+}
+
+func TestMineKeepsDirectives(t *testing.T) {
+	run := "RUN apk add a b c `\n    d e\n"
+	files := map[string]string{
+		"a": "# escape=`\nFROM alpine\n" + run + "COPY . .\n",
+		"b": "# escape=`\nFROM alpine AS app\n" + run,
+		// the same command, but read with another escape
+		"c": "FROM alpine\nRUN apk add a b c d e\n",
+		"d": "# syntax=docker/dockerfile:1\nFROM alpine\nRUN apk add a b c \\\n    d e\n",
+		"e": "# syntax=docker/dockerfile:1\nFROM alpine\nRUN apk add a b c \\\n    d e\n",
+	}
+	rep := mine(t, files, "a", "b", "c", "d", "e")
+	bases := map[string]bool{}
+	for _, p := range rep.Prefixes {
+		bases[p.Base] = true
+	}
+	for _, want := range []string{
+		"# escape=`\nFROM alpine\n" + run,
+		"# syntax=docker/dockerfile:1\nFROM alpine\nRUN apk add a b c \\\n    d e\n",
+	} {
+		if !bases[want] {
+			t.Errorf("no base %q among %v", want, bases)
+		}
+	}
+	if len(rep.Prefixes) != 2 {
+		t.Errorf("got %d prefixes, want c left out", len(rep.Prefixes))
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/corpus"
+	"github.com/btwiuse/buildahfy/prefix"
+)
+
+// prefixesMain finds instruction sequences that stages across the corpus
+// start with, and proposes a shared base image for each.
+func prefixesMain(args []string) {
+	format, image, dir := "", "", ""
+	minStages, minLength, jobs := 0, 0, 0
+	fs := flag.NewFlagSet("prefixes", flag.ExitOnError)
+	fs.StringVar(&format, "format", "text", "output format: text or json")
+	fs.StringVar(&image, "image", "shared-base", "name of the proposed base images, numbered from 1")
+	fs.IntVar(&minStages, "min-stages", 2, "least number of stages a prefix must be shared by")
+	fs.IntVar(&minLength, "min-length", 2, "least number of instructions in a prefix, counting the FROM")
+	fs.StringVar(&dir, "write", "", "write the base Dockerfiles and the rewritten children under `dir`")
+	fs.IntVar(&jobs, "j", runtime.NumCPU(), "number of records to process in parallel")
+	path := addStoreFlag(fs)
+	in := addInputFlags(fs)
+	fs.Parse(args)
+	checkFormat(format, "text", "json")
+
+	st := openStore(*path)
+	defer st.Close()
+	rep := prefix.NewReport()
+	parse := func(rec *corpus.Record) interface{} {
+		res, _, err := parseStored(st, rec)
+		if err != nil {
+			return (*prefix.File)(nil)
+		}
+		f, err := prefix.ParseResult(rec.Id, []byte(rec.Contents), res)
+		if err != nil {
+			return (*prefix.File)(nil)
+		}
+		return f
+	}
+	emit := func(rec *corpus.Record, res interface{}) error {
+		rep.Add(res.(*prefix.File))
+		return nil
+	}
+	if err := in.mapRecords(nil, jobs, parse, emit); err != nil {
+		mapFailed(err)
+	}
+	rep.Mine(image, minStages, minLength)
+
+	var err error
+	switch format {
+	case "text":
+		err = rep.WriteText(os.Stdout)
+	case "json":
+		err = rep.WriteJSON(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if dir != "" {
+		writeProposal(dir, rep)
+	}
+}
+
+// writeProposal writes each base Dockerfile to dir/<image>/Dockerfile and
+// each rewritten child to dir/children/<id>.
+func writeProposal(dir string, rep *prefix.Report) {
+	write := func(path, contents string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			log.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, p := range rep.Prefixes {
+		write(filepath.Join(dir, p.Image, "Dockerfile"), p.Base)
+	}
+	for _, c := range rep.Children() {
+		// keep ids such as ../x or commit:path inside dir
+		id := filepath.Clean("/" + strings.Replace(c.Id, ":", "/", -1))
+		write(filepath.Join(dir, "children", filepath.FromSlash(id)), c.Dockerfile)
+	}
+}
@@ -0,0 +1,213 @@
+package query
+
+import (
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/command"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// Facts is what queries can ask about one Dockerfile. It is built from
+// the parse tree alone, so files the instructions package rejects can
+// still be selected.
+type Facts struct {
+	Id    string
+	nodes []*parser.Node
+	lines int
+}
+
+func NewFacts(id string, r io.Reader) (*Facts, error) {
+	res, err := parser.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewFactsAST(id, res.AST), nil
+}
+
+// NewFactsAST is NewFacts for a Dockerfile already parsed into ast.
+func NewFactsAST(id string, ast *parser.Node) *Facts {
+	return &Facts{Id: id, nodes: ast.Children, lines: ast.EndLine}
+}
+
+// number returns the value of a numeric field.
+func (f *Facts) number(name string) (int, bool) {
+	switch name {
+	case "stages":
+		return f.count(command.From), true
+	case "instructions":
+		return len(f.nodes), true
+	case "lines":
+		return f.lines, true
+	}
+	return 0, false
+}
+
+func (f *Facts) count(keyword string) int {
+	n := 0
+	for _, node := range f.nodes {
+		if node.Value == strings.ToLower(keyword) {
+			n++
+		}
+	}
+	return n
+}
+
+// strings returns the values of a string field: the Id, the base of
+// each stage, or the arguments of each instruction with the field's
+// name.
+func (f *Facts) strings(name string) []string {
+	switch name {
+	case "id":
+		return []string{f.Id}
+	case "from":
+		bases := []string{}
+		for _, n := range f.nodes {
+			if n.Value == command.From && n.Next != nil {
+				bases = append(bases, n.Next.Value)
+			}
+		}
+		return bases
+	}
+	values := []string{}
+	for _, n := range f.nodes {
+		if n.Value == name {
+			values = append(values, arguments(n))
+		}
+	}
+	return values
+}
+
+// Field returns the values of a field as strings, for stratifying.
+func (f *Facts) Field(name string) []string {
+	if n, ok := f.number(name); ok {
+		return []string{strconv.Itoa(n)}
+	}
+	return f.strings(name)
+}
+
+func arguments(n *parser.Node) string {
+	words := []string{}
+	for a := n.Next; a != nil; a = a.Next {
+		words = append(words, a.Value)
+	}
+	return strings.Join(words, " ")
+}
+
+// has reports whether an instruction has the keyword and flags of the
+// pattern and contains its remaining words, as in has(RUN --mount=type=cache)
+// or has(RUN apt-get).
+func (f *Facts) has(pattern string) bool {
+	words := strings.Fields(pattern)
+	if len(words) == 0 {
+		return false
+	}
+	keyword, flags, text := strings.ToLower(words[0]), []string{}, []string{}
+	for _, w := range words[1:] {
+		if strings.HasPrefix(w, "--") {
+			flags = append(flags, w)
+		} else {
+			text = append(text, w)
+		}
+	}
+	for _, n := range f.nodes {
+		if n.Value != keyword || !hasFlags(n.Flags, flags) {
+			continue
+		}
+		if args := arguments(n); strings.Contains(args, strings.Join(text, " ")) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasFlags(have, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if flagMatches(h, w) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// flagMatches compares a flag with a pattern. A pattern without a value
+// matches any value, and a pattern of comma-separated key=value pairs,
+// like --mount=type=cache, matches a flag that has all of them.
+func flagMatches(flag, pattern string) bool {
+	fk := strings.SplitN(flag, "=", 2)
+	pk := strings.SplitN(pattern, "=", 2)
+	if fk[0] != pk[0] {
+		return false
+	}
+	if len(pk) == 1 {
+		return true
+	}
+	if len(fk) == 1 {
+		return false
+	}
+	if fk[1] == pk[1] {
+		return true
+	}
+	if !strings.Contains(pk[1], "=") {
+		return false
+	}
+	fields := map[string]bool{}
+	for _, field := range strings.Split(fk[1], ",") {
+		fields[field] = true
+	}
+	for _, field := range strings.Split(pk[1], ",") {
+		if !fields[field] {
+			return false
+		}
+	}
+	return true
+}
+
+// compareStrings applies a string operator to the values of a field.
+// = and ~ hold if any value matches, != and !~ if none does.
+func compareStrings(values []string, op, want string, re *regexp.Regexp) bool {
+	match := func(v string) bool {
+		if re != nil {
+			return re.MatchString(v)
+		}
+		return v == want
+	}
+	any := false
+	for _, v := range values {
+		if match(v) {
+			any = true
+			break
+		}
+	}
+	if op == "!=" || op == "!~" {
+		return !any
+	}
+	return any
+}
+
+func compareNumbers(have int, op string, want int) bool {
+	switch op {
+	case "=":
+		return have == want
+	case "!=":
+		return have != want
+	case "<":
+		return have < want
+	case "<=":
+		return have <= want
+	case ">":
+		return have > want
+	case ">=":
+		return have >= want
+	}
+	return false
+}
@@ -0,0 +1,301 @@
+// Package query selects corpus records with predicates over their
+// parsed instructions, such as
+//
+//	stages>2 && has(RUN --mount=type=cache)
+//	from~"^alpine" || uses(ONBUILD)
+//	healthcheck=NONE && !(count(RUN)>=10)
+//
+// Fields are stages, instructions and lines, which are numbers, and id,
+// from and the name of any instruction, which are strings; an
+// instruction field holds the arguments of each such instruction.
+// Numbers compare with = != < <= > >=, strings with = != and the regexp
+// matches ~ and !~. has(...) matches an instruction by keyword, flags
+// and text, uses(KEYWORD) tests for a keyword and count(KEYWORD) counts
+// it. Parentheses in the argument of a function must balance, or be
+// quoted or escaped.
+package query
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// Expr is a parsed query.
+type Expr interface {
+	Match(f *Facts) bool
+}
+
+type or []Expr
+
+func (e or) Match(f *Facts) bool {
+	for _, x := range e {
+		if x.Match(f) {
+			return true
+		}
+	}
+	return false
+}
+
+type and []Expr
+
+func (e and) Match(f *Facts) bool {
+	for _, x := range e {
+		if !x.Match(f) {
+			return false
+		}
+	}
+	return true
+}
+
+type not struct{ Expr }
+
+func (e not) Match(f *Facts) bool {
+	return !e.Expr.Match(f)
+}
+
+type predicate func(f *Facts) bool
+
+func (p predicate) Match(f *Facts) bool {
+	return p(f)
+}
+
+// Parse parses a query.
+func Parse(s string) (Expr, error) {
+	p := &exprParser{s: s}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.skip(); p.pos < len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+	return e, nil
+}
+
+type exprParser struct {
+	s   string
+	pos int
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return errors.Errorf("query column %d: %s", p.pos+1, errors.Errorf(format, args...))
+}
+
+func (p *exprParser) skip() {
+	for p.pos < len(p.s) && unicode.IsSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+// accept consumes tok if it comes next.
+func (p *exprParser) accept(tok string) bool {
+	p.skip()
+	if strings.HasPrefix(p.s[p.pos:], tok) {
+		p.pos += len(tok)
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) or() (Expr, error) {
+	e, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	terms := or{e}
+	for p.accept("||") {
+		if e, err = p.and(); err != nil {
+			return nil, err
+		}
+		terms = append(terms, e)
+	}
+	if len(terms) == 1 {
+		return e, nil
+	}
+	return terms, nil
+}
+
+func (p *exprParser) and() (Expr, error) {
+	e, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	terms := and{e}
+	for p.accept("&&") {
+		if e, err = p.unary(); err != nil {
+			return nil, err
+		}
+		terms = append(terms, e)
+	}
+	if len(terms) == 1 {
+		return e, nil
+	}
+	return terms, nil
+}
+
+func (p *exprParser) unary() (Expr, error) {
+	if p.accept("!") {
+		e, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return not{e}, nil
+	}
+	if p.accept("(") {
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, p.errorf("missing )")
+		}
+		return e, nil
+	}
+	return p.predicate()
+}
+
+func (p *exprParser) ident() string {
+	p.skip()
+	start := p.pos
+	for p.pos < len(p.s) && (unicode.IsLetter(rune(p.s[p.pos])) || p.s[p.pos] == '_') {
+		p.pos++
+	}
+	return strings.ToLower(p.s[start:p.pos])
+}
+
+// call reads the raw argument of has(...), uses(...) or count(...),
+// up to the parenthesis that closes the call. Parentheses in the
+// argument must balance unless quoted, as in has(RUN echo "(").
+func (p *exprParser) call() (string, error) {
+	depth, quote := 0, byte(0)
+	for i := p.pos; i < len(p.s); i++ {
+		c := p.s[i]
+		switch {
+		case c == '\\' && quote != '\'':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case c == ')':
+			arg := strings.TrimSpace(p.s[p.pos:i])
+			p.pos = i + 1
+			return arg, nil
+		}
+	}
+	return "", p.errorf("missing )")
+}
+
+var operators = []string{"!=", "!~", "<=", ">=", "=", "~", "<", ">"}
+
+func (p *exprParser) operator() (string, error) {
+	for _, op := range operators {
+		if p.accept(op) {
+			return op, nil
+		}
+	}
+	return "", p.errorf("expected one of %s", strings.Join(operators, " "))
+}
+
+// value reads a quoted string or a bare word.
+func (p *exprParser) value() (string, error) {
+	p.skip()
+	if p.pos < len(p.s) && p.s[p.pos] == '"' {
+		prefix, err := strconv.QuotedPrefix(p.s[p.pos:])
+		if err != nil {
+			return "", p.errorf("bad string")
+		}
+		p.pos += len(prefix)
+		return strconv.Unquote(prefix)
+	}
+	start := p.pos
+	for p.pos < len(p.s) && !unicode.IsSpace(rune(p.s[p.pos])) && !strings.ContainsRune("()&|", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	if start == p.pos {
+		return "", p.errorf("expected a value")
+	}
+	return p.s[start:p.pos], nil
+}
+
+func (p *exprParser) predicate() (Expr, error) {
+	name := p.ident()
+	if name == "" {
+		return nil, p.errorf("expected a field or function")
+	}
+	if p.accept("(") {
+		arg, err := p.call()
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "has":
+			return predicate(func(f *Facts) bool { return f.has(arg) }), nil
+		case "uses":
+			return predicate(func(f *Facts) bool { return f.count(arg) > 0 }), nil
+		case "count":
+			return p.comparison(func(f *Facts) int { return f.count(arg) })
+		}
+		return nil, p.errorf("unknown function %s", name)
+	}
+	switch name {
+	case "stages", "instructions", "lines":
+		return p.comparison(func(f *Facts) int {
+			n, _ := f.number(name)
+			return n
+		})
+	}
+	op, err := p.operator()
+	if err != nil {
+		return nil, err
+	}
+	want, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	var re *regexp.Regexp
+	switch op {
+	case "~", "!~":
+		if re, err = regexp.Compile(want); err != nil {
+			return nil, p.errorf("%v", err)
+		}
+	case "=", "!=":
+	default:
+		return nil, p.errorf("%s is a string field, %s compares numbers", name, op)
+	}
+	return predicate(func(f *Facts) bool {
+		return compareStrings(f.strings(name), op, want, re)
+	}), nil
+}
+
+// comparison reads the operator and number that follow a numeric field.
+func (p *exprParser) comparison(field func(f *Facts) int) (Expr, error) {
+	op, err := p.operator()
+	if err != nil {
+		return nil, err
+	}
+	if op == "~" || op == "!~" {
+		return nil, p.errorf("%s does not compare numbers", op)
+	}
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	want, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, p.errorf("expected a number, got %q", v)
+	}
+	return predicate(func(f *Facts) bool {
+		return compareNumbers(field(f), op, want)
+	}), nil
+}
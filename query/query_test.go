@@ -0,0 +1,118 @@
+package query
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/btwiuse/buildahfy/corpus"
+)
+
+const dockerfile = `FROM golang:1.13 AS build
+RUN --mount=type=cache,target=/root/.cache go build -o /app .
+FROM alpine:3.10
+COPY --from=build /app /app
+HEALTHCHECK NONE
+ONBUILD RUN echo hi
+`
+
+func TestMatch(t *testing.T) {
+	facts, err := NewFacts("svc/Dockerfile", strings.NewReader(dockerfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for query, want := range map[string]bool{
+		"stages=2":                                  true,
+		"stages>2":                                  false,
+		"instructions>=6 && lines<=6":               true,
+		`from~"^alpine"`:                            true,
+		`from="debian"`:                             false,
+		`from!~"^debian"`:                           true,
+		`id~"^svc/"`:                                true,
+		"has(RUN --mount=type=cache)":               true,
+		"has(RUN --mount=type=secret)":              false,
+		"has(RUN --mount)":                          true,
+		"has(RUN go build)":                         true,
+		"has(COPY --from=build)":                    true,
+		"uses(ONBUILD)":                             true,
+		"uses(SHELL)":                               false,
+		"count(FROM)=2 && !(count(RUN)>=10)":        true,
+		"healthcheck=NONE":                          true,
+		"stages>2 || uses(HEALTHCHECK)":             true,
+		"!(uses(HEALTHCHECK) && has(RUN --mount))":  false,
+		`(stages=1 || from~"golang") && uses(COPY)`: true,
+	} {
+		expr, err := Parse(query)
+		if err != nil {
+			t.Errorf("%s: %v", query, err)
+			continue
+		}
+		if got := expr.Match(facts); got != want {
+			t.Errorf("%s: got %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, query := range []string{
+		"",
+		"stages>",
+		"stages>x",
+		"has(RUN",
+		"has(RUN echo (x)",
+		`has(RUN echo ")`,
+		"uses(RUN) &&",
+		"stages=2 extra",
+		`from~"["`,
+	} {
+		if _, err := Parse(query); err == nil {
+			t.Errorf("%q parsed", query)
+		}
+	}
+}
+
+func TestCallArgumentParentheses(t *testing.T) {
+	facts, err := NewFacts("a", strings.NewReader("FROM alpine\nRUN echo (x) && echo \")\" && echo \\(\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for query, want := range map[string]bool{
+		"has(RUN echo (x))":              true,
+		"has(RUN echo (y))":              false,
+		`has(RUN echo ")") && stages=1`:  true,
+		`has(RUN echo \() && uses(FROM)`: true,
+		"has(RUN (echo (x)))":            false,
+	} {
+		expr, err := Parse(query)
+		if err != nil {
+			t.Errorf("%s: %v", query, err)
+			continue
+		}
+		if got := expr.Match(facts); got != want {
+			t.Errorf("%s: got %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestSamplerKeepsOrderAndSize(t *testing.T) {
+	s := NewSampler(3, 1)
+	for i := 0; i < 100; i++ {
+		stratum := "even"
+		if i%2 == 1 {
+			stratum = "odd"
+		}
+		s.Add(stratum, &corpus.Record{Result: corpus.Result{Id: strconv.Itoa(i)}})
+	}
+	recs := s.Records()
+	if len(recs) != 6 {
+		t.Fatalf("got %d records, want 3 per stratum", len(recs))
+	}
+	last := -1
+	for _, rec := range recs {
+		i, _ := strconv.Atoi(rec.Id)
+		if i <= last {
+			t.Errorf("records out of input order: %d after %d", i, last)
+		}
+		last = i
+	}
+}
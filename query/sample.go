@@ -0,0 +1,64 @@
+package query
+
+import (
+	"math/rand"
+	"sort"
+
+	"github.com/btwiuse/buildahfy/corpus"
+)
+
+// Sampler keeps a uniform random sample of at most n records from each
+// stratum, by reservoir sampling, so the corpus is read only once.
+type Sampler struct {
+	n      int
+	rand   *rand.Rand
+	strata map[string]*reservoir
+	seen   int
+}
+
+type reservoir struct {
+	seen    int
+	records []sampled
+}
+
+type sampled struct {
+	index int
+	rec   *corpus.Record
+}
+
+func NewSampler(n int, seed int64) *Sampler {
+	return &Sampler{n: n, rand: rand.New(rand.NewSource(seed)), strata: map[string]*reservoir{}}
+}
+
+// Add offers a record from the given stratum; use "" when not
+// stratifying.
+func (s *Sampler) Add(stratum string, rec *corpus.Record) {
+	s.seen++
+	r, ok := s.strata[stratum]
+	if !ok {
+		r = &reservoir{}
+		s.strata[stratum] = r
+	}
+	r.seen++
+	if len(r.records) < s.n {
+		r.records = append(r.records, sampled{s.seen, rec})
+		return
+	}
+	if i := s.rand.Intn(r.seen); i < s.n {
+		r.records[i] = sampled{s.seen, rec}
+	}
+}
+
+// Records returns the sample in input order.
+func (s *Sampler) Records() []*corpus.Record {
+	all := []sampled{}
+	for _, r := range s.strata {
+		all = append(all, r.records...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].index < all[j].index })
+	recs := []*corpus.Record{}
+	for _, x := range all {
+		recs = append(recs, x.rec)
+	}
+	return recs
+}
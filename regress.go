@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/corpus"
+	"github.com/btwiuse/buildahfy/regress"
+	"github.com/btwiuse/buildahfy/translate"
+)
+
+// side is one of the two sets of translations regress compares: either
+// saved, or made now from the corpus.
+type side struct {
+	saved    *regress.Set
+	annotate bool
+}
+
+// parseSide reads a side given as ndjson:path for a saved set, or as
+// translate[:annotate] to translate the corpus now.
+func parseSide(spec string) *side {
+	parts := strings.SplitN(spec, ":", 2)
+	switch {
+	case parts[0] == "ndjson" && len(parts) == 2:
+		f, err := os.Open(parts[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		set, err := regress.Load(f)
+		if err != nil {
+			log.Fatalf("%s: %v", parts[1], err)
+		}
+		return &side{saved: set}
+	case spec == "translate":
+		return &side{}
+	case spec == "translate:annotate":
+		return &side{annotate: true}
+	}
+	log.Fatalf("unknown translation set %q", spec)
+	return nil
+}
+
+func (s *side) translate(rec *corpus.Record) *translate.Record {
+	if s.saved != nil {
+		return s.saved.Records[rec.Id]
+	}
+	return translate.Translate(rec.Id, strings.NewReader(rec.Contents), s.annotate)
+}
+
+// regressMain compares two sets of translations of the corpus, such as
+// those of the translator before and after a change.
+func regressMain(args []string) {
+	oldSpec, newSpec, format, examples, jobs := "", "", "", 0, 0
+	fs := flag.NewFlagSet("regress", flag.ExitOnError)
+	fs.StringVar(&oldSpec, "old", "", "old translations: ndjson:`path` for those saved by translate -format ndjson, or translate[:annotate] to translate the corpus now")
+	fs.StringVar(&newSpec, "new", "translate", "new translations, given like -old")
+	fs.StringVar(&format, "format", "text", "output format: text or json for a summary, or ndjson for the diff of each changed record")
+	fs.IntVar(&examples, "examples", 3, "number of changes to show per instruction")
+	fs.IntVar(&jobs, "j", runtime.NumCPU(), "number of records to process in parallel")
+	in := addInputFlags(fs)
+	fs.Parse(args)
+	checkFormat(format, "text", "json", "ndjson")
+	if oldSpec == "" {
+		log.Fatal("-old is required")
+	}
+	old, new := parseSide(oldSpec), parseSide(newSpec)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	rep := regress.NewReport(examples)
+	seen := map[string]bool{}
+	add := func(d *regress.Diff) error {
+		seen[d.Id] = true
+		rep.Add(d)
+		if format == "ndjson" && d.Kind != regress.Unchanged {
+			return enc.Encode(d)
+		}
+		return nil
+	}
+
+	if old.saved == nil || new.saved == nil {
+		compare := func(rec *corpus.Record) interface{} {
+			o, n := old.translate(rec), new.translate(rec)
+			if o == nil && n == nil {
+				return (*regress.Diff)(nil)
+			}
+			return regress.Compare(o, n)
+		}
+		emit := func(rec *corpus.Record, res interface{}) error {
+			if d := res.(*regress.Diff); d != nil {
+				return add(d)
+			}
+			return nil
+		}
+		if err := in.mapRecords(nil, jobs, compare, emit); err != nil {
+			mapFailed(err)
+		}
+	}
+	// records of saved sets that the corpus did not have
+	for _, s := range []*side{old, new} {
+		if s.saved == nil {
+			continue
+		}
+		for _, id := range s.saved.Ids {
+			if seen[id] {
+				continue
+			}
+			var o, n *translate.Record
+			if old.saved != nil {
+				o = old.saved.Records[id]
+			}
+			if new.saved != nil {
+				n = new.saved.Records[id]
+			}
+			if err := add(regress.Compare(o, n)); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	var err error
+	switch format {
+	case "text":
+		err = rep.WriteText(os.Stdout)
+	case "json":
+		err = rep.WriteJSON(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
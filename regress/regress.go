@@ -0,0 +1,183 @@
+// Package regress compares two sets of translations of the same corpus,
+// such as those of two translator versions, record by record and
+// instruction by instruction.
+package regress
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/translate"
+	"github.com/pkg/errors"
+)
+
+// Kind says how the translation of a record changed.
+type Kind string
+
+const (
+	Unchanged Kind = "unchanged"
+	// Changed records have different output but the same status.
+	Changed Kind = "changed"
+	// Regressed records have a worse status, and Fixed ones a better.
+	Regressed Kind = "regressed"
+	Fixed     Kind = "fixed"
+	// Added records are only in the new set, and Removed only in the old.
+	Added   Kind = "added"
+	Removed Kind = "removed"
+)
+
+// Diff is how the translation of one record changed.
+type Diff struct {
+	Id   string           `json:"id"`
+	Kind Kind             `json:"kind"`
+	Old  translate.Status `json:"old,omitempty"`
+	New  translate.Status `json:"new,omitempty"`
+	// Message explains the failure of a record that failed on either
+	// side, whose instructions are then not compared.
+	Message string   `json:"message,omitempty"`
+	Changes []Change `json:"changes"`
+}
+
+// Change is an instruction whose output differs.
+type Change struct {
+	// Instruction is the keyword of the instruction, such as RUN.
+	Instruction string   `json:"instruction"`
+	Line        int      `json:"line"`
+	Source      string   `json:"source"`
+	Old         []string `json:"old"`
+	New         []string `json:"new"`
+}
+
+// output is what one side wrote for an instruction.
+type output struct {
+	line   int
+	source string
+	lines  []string
+}
+
+// Compare diffs the translations of a record; either may be nil when the
+// record is missing from its set.
+func Compare(old, new *translate.Record) *Diff {
+	switch {
+	case old == nil:
+		return &Diff{Id: new.Id, Kind: Added, New: new.Status, Changes: []Change{}}
+	case new == nil:
+		return &Diff{Id: old.Id, Kind: Removed, Old: old.Status, Changes: []Change{}}
+	}
+	d := &Diff{Id: new.Id, Kind: Unchanged, Old: old.Status, New: new.Status, Changes: []Change{}}
+	switch {
+	case new.Status.Worse(old.Status):
+		d.Kind = Regressed
+	case old.Status.Worse(new.Status):
+		d.Kind = Fixed
+	}
+	if old.Status == translate.Failed || new.Status == translate.Failed {
+		if d.Message = failure(new); d.Message == "" {
+			d.Message = failure(old)
+		}
+		if d.Kind == Unchanged && failure(new) != failure(old) {
+			d.Kind = Changed
+		}
+		return d
+	}
+
+	olds, news := outputs(old), outputs(new)
+	keys := map[[2]int]bool{}
+	for k := range olds {
+		keys[k] = true
+	}
+	for k := range news {
+		keys[k] = true
+	}
+	sorted := [][2]int{}
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i][0] < sorted[j][0] })
+	for _, k := range sorted {
+		o, n := olds[k], news[k]
+		if o != nil && n != nil && strings.Join(o.lines, "\n") == strings.Join(n.lines, "\n") {
+			continue
+		}
+		c := Change{Old: []string{}, New: []string{}}
+		for _, out := range []*output{o, n} {
+			if out != nil {
+				c.Line, c.Source = out.line, out.source
+			}
+		}
+		if o != nil {
+			c.Old = o.lines
+		}
+		if n != nil {
+			c.New = n.lines
+		}
+		c.Instruction = strings.ToUpper(strings.SplitN(c.Source, " ", 2)[0])
+		d.Changes = append(d.Changes, c)
+	}
+	if d.Kind == Unchanged && len(d.Changes) > 0 {
+		d.Kind = Changed
+	}
+	return d
+}
+
+// outputs splits the script of rec by the instruction it came from,
+// keyed by the Dockerfile lines of the instruction.
+func outputs(rec *translate.Record) map[[2]int]*output {
+	lines := strings.Split(rec.Script, "\n")
+	outs := map[[2]int]*output{}
+	for _, m := range rec.SourceMap {
+		first, last := m.Output[0], m.Output[1]
+		if first < 1 || last > len(lines) || first > last {
+			continue
+		}
+		outs[m.Source] = &output{
+			line:   m.Source[0],
+			source: m.Instruction,
+			lines:  lines[first-1 : last],
+		}
+	}
+	return outs
+}
+
+// failure returns the message of the diagnostic that failed rec.
+func failure(rec *translate.Record) string {
+	if rec.Status != translate.Failed {
+		return ""
+	}
+	for _, d := range rec.Diagnostics {
+		if d.Status == translate.Failed {
+			return d.Message
+		}
+	}
+	return ""
+}
+
+// Set is a saved set of translations, as written by translate -format
+// ndjson, in the order they were written.
+type Set struct {
+	Ids     []string
+	Records map[string]*translate.Record
+}
+
+// Load reads a saved set. A later record with the Id of an earlier one
+// replaces it.
+func Load(r io.Reader) (*Set, error) {
+	set := &Set{Records: map[string]*translate.Record{}}
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		rec := &translate.Record{}
+		err := dec.Decode(rec)
+		if err == io.EOF {
+			return set, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "record %d", n)
+		}
+		if _, ok := set.Records[rec.Id]; !ok {
+			set.Ids = append(set.Ids, rec.Id)
+		}
+		set.Records[rec.Id] = rec
+	}
+}
@@ -0,0 +1,83 @@
+package regress
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/btwiuse/buildahfy/translate"
+)
+
+func record(id, dockerfile string) *translate.Record {
+	return translate.Translate(id, strings.NewReader(dockerfile), false)
+}
+
+func TestCompareChanged(t *testing.T) {
+	old := record("a", "FROM alpine\nRUN echo old\nUSER nobody\n")
+	new := record("a", "FROM alpine\nRUN echo new\nUSER nobody\n")
+	d := Compare(old, new)
+	if d.Kind != Changed {
+		t.Fatalf("kind %s, want changed", d.Kind)
+	}
+	if len(d.Changes) != 1 {
+		t.Fatalf("changes %+v, want only the RUN", d.Changes)
+	}
+	c := d.Changes[0]
+	if c.Instruction != "RUN" || c.Line != 2 {
+		t.Errorf("change of %s at line %d, want RUN at 2", c.Instruction, c.Line)
+	}
+	if !strings.Contains(strings.Join(c.Old, "\n"), "echo old") || !strings.Contains(strings.Join(c.New, "\n"), "echo new") {
+		t.Errorf("change %+v lacks the RUN output", c)
+	}
+}
+
+func TestCompareUnchanged(t *testing.T) {
+	dockerfile := "FROM alpine\nRUN true\n"
+	if d := Compare(record("a", dockerfile), record("a", dockerfile)); d.Kind != Unchanged || len(d.Changes) != 0 {
+		t.Errorf("diff %+v, want unchanged", d)
+	}
+}
+
+func TestCompareStatus(t *testing.T) {
+	good := record("a", "FROM alpine\nRUN true\n")
+	bad := record("a", "FROM alpine\nFOO bar\n")
+	if bad.Status != translate.Failed {
+		t.Fatalf("status %s, want failed", bad.Status)
+	}
+	d := Compare(good, bad)
+	if d.Kind != Regressed || d.Message == "" {
+		t.Errorf("diff %+v, want regressed with a message", d)
+	}
+	if d := Compare(bad, good); d.Kind != Fixed {
+		t.Errorf("kind %s, want fixed", d.Kind)
+	}
+}
+
+func TestCompareMissing(t *testing.T) {
+	rec := record("a", "FROM alpine\n")
+	if d := Compare(nil, rec); d.Kind != Added || d.Id != "a" {
+		t.Errorf("diff %+v, want a added", d)
+	}
+	if d := Compare(rec, nil); d.Kind != Removed || d.Id != "a" {
+		t.Errorf("diff %+v, want a removed", d)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	input := `{"id":"a","status":"translated","script":"one"}
+{"id":"b","status":"translated"}
+{"id":"a","status":"translated","script":"two"}
+`
+	set, err := Load(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(set.Ids, " ") != "a b" {
+		t.Errorf("ids %q, want a b", set.Ids)
+	}
+	if set.Records["a"].Script != "two" {
+		t.Errorf("script %q, want the later record", set.Records["a"].Script)
+	}
+	if _, err := Load(strings.NewReader(input + "{\n")); err == nil || !strings.Contains(err.Error(), "record 4") {
+		t.Errorf("got %v, want an error at record 4", err)
+	}
+}
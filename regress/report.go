@@ -0,0 +1,140 @@
+package regress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Report aggregates the diffs of a corpus.
+type Report struct {
+	Records int          `json:"records"`
+	Kinds   map[Kind]int `json:"kinds"`
+	// Instructions groups the changed instructions by keyword.
+	Instructions map[string]*Group `json:"instructions"`
+	// NewFailures and Fixes are the records that Regressed and Fixed.
+	NewFailures []*Diff `json:"newFailures"`
+	Fixes       []*Diff `json:"fixes"`
+
+	examples int
+}
+
+// Group is the changes made to one kind of instruction.
+type Group struct {
+	Records int `json:"records"`
+	Changes int `json:"changes"`
+	// Examples are the first changes of the group, with the records
+	// they were found in.
+	Examples []Example `json:"examples"`
+}
+
+type Example struct {
+	Id string `json:"id"`
+	Change
+}
+
+// NewReport returns a report that keeps up to examples changes of each
+// instruction.
+func NewReport(examples int) *Report {
+	return &Report{
+		Kinds:        map[Kind]int{},
+		Instructions: map[string]*Group{},
+		NewFailures:  []*Diff{},
+		Fixes:        []*Diff{},
+		examples:     examples,
+	}
+}
+
+func (rep *Report) Add(d *Diff) {
+	rep.Records++
+	rep.Kinds[d.Kind]++
+	switch d.Kind {
+	case Regressed:
+		rep.NewFailures = append(rep.NewFailures, d)
+	case Fixed:
+		rep.Fixes = append(rep.Fixes, d)
+	}
+	seen := map[string]bool{}
+	for _, c := range d.Changes {
+		g, ok := rep.Instructions[c.Instruction]
+		if !ok {
+			g = &Group{Examples: []Example{}}
+			rep.Instructions[c.Instruction] = g
+		}
+		g.Changes++
+		if !seen[c.Instruction] {
+			seen[c.Instruction] = true
+			g.Records++
+		}
+		if len(g.Examples) < rep.examples {
+			g.Examples = append(g.Examples, Example{Id: d.Id, Change: c})
+		}
+	}
+}
+
+func (rep *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rep)
+}
+
+var kinds = []Kind{Unchanged, Changed, Regressed, Fixed, Added, Removed}
+
+func (rep *Report) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "%d records\n", rep.Records)
+	for _, k := range kinds {
+		fmt.Fprintf(w, "%-12s %8d\n", k, rep.Kinds[k])
+	}
+
+	names := []string{}
+	for name := range rep.Instructions {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := rep.Instructions[names[i]], rep.Instructions[names[j]]
+		if a.Changes != b.Changes {
+			return a.Changes > b.Changes
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		g := rep.Instructions[name]
+		fmt.Fprintf(w, "\n%s: %d changes in %d records\n", name, g.Changes, g.Records)
+		for _, ex := range g.Examples {
+			fmt.Fprintf(w, "  %s line %d: %s\n", ex.Id, ex.Line, ex.Source)
+			for _, line := range ex.Old {
+				fmt.Fprintf(w, "    - %s\n", line)
+			}
+			for _, line := range ex.New {
+				fmt.Fprintf(w, "    + %s\n", line)
+			}
+		}
+	}
+
+	for _, section := range []struct {
+		name  string
+		diffs []*Diff
+	}{{"new failures", rep.NewFailures}, {"fixes", rep.Fixes}} {
+		if len(section.diffs) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s: %d records\n", section.name, len(section.diffs))
+		for _, d := range section.diffs {
+			fmt.Fprintf(w, "  %s: %s -> %s%s\n", d.Id, d.Old, d.New, reason(d))
+		}
+	}
+	return nil
+}
+
+// reason says briefly why a record's status changed.
+func reason(d *Diff) string {
+	if d.Message != "" {
+		return " (" + d.Message + ")"
+	}
+	if len(d.Changes) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d instructions changed, first %s on line %d)", len(d.Changes), d.Changes[0].Instruction, d.Changes[0].Line)
+}
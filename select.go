@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"runtime"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/corpus"
+	"github.com/btwiuse/buildahfy/query"
+	"github.com/btwiuse/pretty"
+)
+
+// selectMain prints the records of the corpus that match a query, or a
+// random sample of them, in the pd json format.
+func selectMain(args []string) {
+	sample, stratify, seed, jobs := 0, "", int64(0), 0
+	fs := flag.NewFlagSet("select", flag.ExitOnError)
+	fs.IntVar(&sample, "sample", 0, "print a random sample of at most `n` matches, or n per stratum with -stratify")
+	fs.StringVar(&stratify, "stratify", "", "sample per value of `field`, such as stages or from")
+	fs.Int64Var(&seed, "seed", 1, "random seed for -sample")
+	fs.IntVar(&jobs, "j", runtime.NumCPU(), "number of records to process in parallel")
+	path := addStoreFlag(fs)
+	in := addInputFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal(`usage: buildahfy select [flags] 'stages>2 && has(RUN --mount=type=cache)'`)
+	}
+	if stratify != "" && sample == 0 {
+		log.Fatal("-stratify needs -sample")
+	}
+	expr, err := query.Parse(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	st := openStore(*path)
+	defer st.Close()
+	sampler := query.NewSampler(sample, seed)
+	match := func(rec *corpus.Record) interface{} {
+		res, _, err := parseStored(st, rec)
+		if err != nil {
+			return (*query.Facts)(nil)
+		}
+		facts := query.NewFactsAST(rec.Id, res.AST)
+		if !expr.Match(facts) {
+			return (*query.Facts)(nil)
+		}
+		return facts
+	}
+	emit := func(rec *corpus.Record, res interface{}) error {
+		facts := res.(*query.Facts)
+		switch {
+		case facts == nil:
+		case sample == 0:
+			pretty.Json(rec.Result)
+		default:
+			sampler.Add(strings.Join(facts.Field(stratify), ","), rec)
+		}
+		return nil
+	}
+	if err := in.mapRecords(nil, jobs, match, emit); err != nil {
+		mapFailed(err)
+	}
+	for _, rec := range sampler.Records() {
+		pretty.Json(rec.Result)
+	}
+}
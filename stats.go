@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/corpus"
+	"github.com/btwiuse/buildahfy/stats"
+)
+
+// statsMain prints instruction, flag and form usage over the corpus.
+func statsMain(args []string) {
+	format, jobs := "", 0
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	fs.StringVar(&format, "format", "text", "output format: text or json")
+	fs.IntVar(&jobs, "j", runtime.NumCPU(), "number of records to process in parallel")
+	path := addStoreFlag(fs)
+	in := addInputFlags(fs)
+	fs.Parse(args)
+	checkFormat(format, "text", "json")
+
+	st := openStore(*path)
+	defer st.Close()
+	rep := stats.New()
+	summarize := func(rec *corpus.Record) interface{} {
+		var s *stats.Summary
+		loadStored(st, bucket("stats"), rec, &s, func() error {
+			s, _ = stats.Summarize(strings.NewReader(rec.Contents))
+			return nil
+		})
+		return s
+	}
+	emit := func(rec *corpus.Record, res interface{}) error {
+		rep.Add(res.(*stats.Summary))
+		return nil
+	}
+	if err := in.mapRecords(nil, jobs, summarize, emit); err != nil {
+		mapFailed(err)
+	}
+
+	var err error
+	switch format {
+	case "text":
+		err = rep.WriteText(os.Stdout)
+	case "json":
+		err = rep.WriteJSON(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
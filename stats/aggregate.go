@@ -0,0 +1,164 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Count is how often something occurs and in how many files.
+type Count struct {
+	Total int `json:"total"`
+	Files int `json:"files"`
+}
+
+// Stats aggregates summaries over a corpus.
+type Stats struct {
+	Files        int               `json:"files"`
+	Failed       int               `json:"failed"`
+	Instructions map[string]*Count `json:"instructions"`
+	Flags        map[string]*Count `json:"flags"`
+	Forms        map[string]*Count `json:"forms"`
+	Stages       map[int]int       `json:"stages"`
+	MetaArgs     int               `json:"metaArgs"`
+	ArgInFrom    int               `json:"argInFrom"`
+	Onbuild      int               `json:"onbuild"`
+
+	fileLines  []int
+	runLengths []int
+}
+
+func New() *Stats {
+	return &Stats{
+		Instructions: map[string]*Count{},
+		Flags:        map[string]*Count{},
+		Forms:        map[string]*Count{},
+		Stages:       map[int]int{},
+		fileLines:    []int{},
+		runLengths:   []int{},
+	}
+}
+
+// Add merges the summary of one file; a nil summary counts as a file
+// that failed to parse.
+func (st *Stats) Add(s *Summary) {
+	st.Files++
+	if s == nil {
+		st.Failed++
+		return
+	}
+	count(st.Instructions, s.Instructions)
+	count(st.Flags, s.Flags)
+	count(st.Forms, s.Forms)
+	st.Stages[s.Stages]++
+	if s.MetaArgs {
+		st.MetaArgs++
+	}
+	if s.ArgInFrom {
+		st.ArgInFrom++
+	}
+	if s.Onbuild {
+		st.Onbuild++
+	}
+	st.fileLines = append(st.fileLines, s.Lines)
+	st.runLengths = append(st.runLengths, s.RunLengths...)
+}
+
+func count(into map[string]*Count, from map[string]int) {
+	for k, n := range from {
+		c, ok := into[k]
+		if !ok {
+			c = &Count{}
+			into[k] = c
+		}
+		c.Total += n
+		c.Files++
+	}
+}
+
+// Percentiles of a distribution.
+type Percentiles struct {
+	P50 int `json:"p50"`
+	P90 int `json:"p90"`
+	P99 int `json:"p99"`
+	Max int `json:"max"`
+}
+
+// PercentilesOf returns the percentiles of values.
+func PercentilesOf(values []int) Percentiles {
+	if len(values) == 0 {
+		return Percentiles{}
+	}
+	sorted := append([]int{}, values...)
+	sort.Ints(sorted)
+	at := func(p int) int {
+		return sorted[(len(sorted)-1)*p/100]
+	}
+	return Percentiles{P50: at(50), P90: at(90), P99: at(99), Max: sorted[len(sorted)-1]}
+}
+
+func (st *Stats) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		*Stats
+		FileLines  Percentiles `json:"fileLines"`
+		RunLengths Percentiles `json:"runLengths"`
+	}{st, PercentilesOf(st.fileLines), PercentilesOf(st.runLengths)})
+}
+
+func (st *Stats) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "%d files, %d failed to parse\n", st.Files, st.Failed)
+	for _, section := range []struct {
+		title  string
+		counts map[string]*Count
+	}{
+		{"instructions", st.Instructions},
+		{"flags", st.Flags},
+		{"forms", st.Forms},
+	} {
+		fmt.Fprintf(w, "\n%-32s %10s %10s\n", section.title, "total", "files")
+		for _, k := range byTotal(section.counts) {
+			fmt.Fprintf(w, "%-32s %10d %10d\n", k, section.counts[k].Total, section.counts[k].Files)
+		}
+	}
+	fmt.Fprintf(w, "\n%-32s %10s\n", "stages", "files")
+	stages := []int{}
+	for n := range st.Stages {
+		stages = append(stages, n)
+	}
+	sort.Ints(stages)
+	for _, n := range stages {
+		fmt.Fprintf(w, "%-32d %10d\n", n, st.Stages[n])
+	}
+	fmt.Fprintf(w, "\n%-32s %10d\n", "ARG before FROM", st.MetaArgs)
+	fmt.Fprintf(w, "%-32s %10d\n", "variable in FROM", st.ArgInFrom)
+	fmt.Fprintf(w, "%-32s %10d\n", "ONBUILD", st.Onbuild)
+	fmt.Fprintf(w, "\n%-32s %8s %8s %8s %8s\n", "percentiles", "p50", "p90", "p99", "max")
+	for _, d := range []struct {
+		name   string
+		values []int
+	}{
+		{"file lines", st.fileLines},
+		{"RUN length (chars)", st.runLengths},
+	} {
+		p := PercentilesOf(d.values)
+		fmt.Fprintf(w, "%-32s %8d %8d %8d %8d\n", d.name, p.P50, p.P90, p.P99, p.Max)
+	}
+	return nil
+}
+
+func byTotal(counts map[string]*Count) []string {
+	keys := []string{}
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]].Total != counts[keys[j]].Total {
+			return counts[keys[i]].Total > counts[keys[j]].Total
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
@@ -0,0 +1,126 @@
+// Package stats aggregates instruction and flag usage over a corpus.
+package stats
+
+import (
+	"io"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/command"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// Summary is what one Dockerfile contributes to the statistics. Keys are
+// uppercased, e.g. "RUN", "COPY --from", "RUN --mount=type=cache" or
+// "CMD exec".
+type Summary struct {
+	Lines        int
+	Instructions map[string]int
+	Flags        map[string]int
+	Forms        map[string]int
+	Stages       int
+	MetaArgs     bool
+	ArgInFrom    bool
+	Onbuild      bool
+	// RunLengths are the lengths of the commands of the RUN
+	// instructions, without the keyword and flags.
+	RunLengths []int
+}
+
+// forms lists the instructions that may be written in shell or exec form.
+var forms = map[string]bool{
+	command.Run:        true,
+	command.Cmd:        true,
+	command.Entrypoint: true,
+	command.Shell:      true,
+	command.Add:        true,
+	command.Copy:       true,
+	command.Volume:     true,
+}
+
+// Summarize parses a Dockerfile with the buildkit parser only, so that
+// files the instructions package rejects are still counted.
+func Summarize(r io.Reader) (*Summary, error) {
+	res, err := parser.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	return FromResult(res), nil
+}
+
+// FromResult summarizes a Dockerfile already parsed into res.
+func FromResult(res *parser.Result) *Summary {
+	s := &Summary{
+		Lines:        res.AST.EndLine,
+		Instructions: map[string]int{},
+		Flags:        map[string]int{},
+		Forms:        map[string]int{},
+		RunLengths:   []int{},
+	}
+	for _, n := range res.AST.Children {
+		s.node(n, "")
+		switch n.Value {
+		case command.From:
+			s.Stages++
+			if n.Next != nil && strings.Contains(n.Next.Value, "$") {
+				s.ArgInFrom = true
+			}
+		case command.Arg:
+			if s.Stages == 0 {
+				s.MetaArgs = true
+			}
+		case command.Run:
+			s.RunLengths = append(s.RunLengths, len(runCommand(n)))
+		case command.Onbuild:
+			s.Onbuild = true
+			if n.Next == nil {
+				break
+			}
+			for _, trigger := range n.Next.Children {
+				s.node(trigger, "ONBUILD ")
+			}
+		}
+	}
+	return s
+}
+
+func (s *Summary) node(n *parser.Node, prefix string) {
+	name := prefix + strings.ToUpper(n.Value)
+	s.Instructions[name]++
+	for _, flag := range n.Flags {
+		s.Flags[name+" "+flagName(flag)]++
+	}
+	if forms[n.Value] {
+		if n.Attributes["json"] {
+			s.Forms[name+" exec"]++
+		} else {
+			s.Forms[name+" shell"]++
+		}
+	}
+}
+
+// runCommand returns the command of a RUN node, its arguments joined
+// by spaces when in exec form.
+func runCommand(n *parser.Node) string {
+	args := []string{}
+	for arg := n.Next; arg != nil; arg = arg.Next {
+		args = append(args, arg.Value)
+	}
+	return strings.Join(args, " ")
+}
+
+// flagName drops the value of a flag, except for the type of a --mount.
+func flagName(flag string) string {
+	parts := strings.SplitN(flag, "=", 2)
+	if parts[0] != "--mount" {
+		return parts[0]
+	}
+	typ := "bind"
+	if len(parts) == 2 {
+		for _, field := range strings.Split(parts[1], ",") {
+			if kv := strings.SplitN(field, "=", 2); len(kv) == 2 && kv[0] == "type" {
+				typ = kv[1]
+			}
+		}
+	}
+	return "--mount=type=" + typ
+}
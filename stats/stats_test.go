@@ -0,0 +1,47 @@
+package stats
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	dt := `ARG version=3.12
+FROM alpine:$version AS build
+RUN --mount=type=cache,target=/var/cache/apk apk add \
+	gcc
+RUN ["make", "all"]
+ONBUILD COPY --from=build /a /b
+FROM build
+CMD echo done
+`
+	s, err := Summarize(strings.NewReader(dt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Lines != 8 || s.Stages != 2 || !s.MetaArgs || !s.ArgInFrom || !s.Onbuild {
+		t.Errorf("lines %d, stages %d, meta args %v, arg in from %v, onbuild %v", s.Lines, s.Stages, s.MetaArgs, s.ArgInFrom, s.Onbuild)
+	}
+	for key, want := range map[string]int{
+		"FROM":                   2,
+		"RUN":                    2,
+		"ONBUILD":                1,
+		"ONBUILD COPY":           1,
+		"RUN --mount=type=cache": 1,
+		"ONBUILD COPY --from":    1,
+		"RUN shell":              1,
+		"RUN exec":               1,
+		"CMD shell":              1,
+		"ONBUILD COPY shell":     1,
+	} {
+		got := s.Instructions[key] + s.Flags[key] + s.Forms[key]
+		if got != want {
+			t.Errorf("%s counted %d times, want %d", key, got, want)
+		}
+	}
+	// only the commands count, not RUN and its flags
+	if want := []int{len("apk add \tgcc"), len("make all")}; !reflect.DeepEqual(s.RunLengths, want) {
+		t.Errorf("run lengths %v, want %v", s.RunLengths, want)
+	}
+}
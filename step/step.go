@@ -0,0 +1,64 @@
+// Package step pairs each Dockerfile instruction with the source lines
+// it was parsed from.
+package step
+
+import (
+	"io"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/pkg/errors"
+)
+
+type Step struct {
+	Node *parser.Node
+	// Instruction is an *instructions.Stage for FROM and an
+	// instructions.Command otherwise.
+	Instruction interface{}
+}
+
+// Source returns the instruction as written, with continuations joined.
+// It is the text dockerfile2llb records as the command of an LLB op.
+func (s Step) Source() string {
+	return strings.TrimSpace(s.Node.Original)
+}
+
+// Parse parses a Dockerfile into one step per instruction.
+func Parse(r io.Reader) ([]Step, error) {
+	res, err := parser.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	return FromAST(res.AST)
+}
+
+// FromAST returns the steps of a Dockerfile already parsed into ast.
+func FromAST(ast *parser.Node) ([]Step, error) {
+	steps := []Step{}
+	for _, n := range ast.Children {
+		ins, err := instructions.ParseInstruction(n)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", n.StartLine)
+		}
+		steps = append(steps, Step{Node: n, Instruction: ins})
+	}
+	return steps, nil
+}
+
+// Stages splits steps into the ARGs before the first FROM and the steps
+// of each stage, each stage starting with its FROM.
+func Stages(steps []Step) (meta []Step, stages [][]Step) {
+	for _, s := range steps {
+		if _, ok := s.Instruction.(*instructions.Stage); ok {
+			stages = append(stages, []Step{s})
+			continue
+		}
+		if len(stages) == 0 {
+			meta = append(meta, s)
+			continue
+		}
+		stages[len(stages)-1] = append(stages[len(stages)-1], s)
+	}
+	return meta, stages
+}
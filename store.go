@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/corpus"
+	"github.com/btwiuse/buildahfy/store"
+	"github.com/btwiuse/buildahfy/translate"
+	"github.com/btwiuse/buildahfy/validate"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/opencontainers/go-digest"
+)
+
+// validations are the checks index runs, by subcommand name.
+var validations = map[string]validate.Func{
+	"validate-ast":    validate.AST,
+	"validate-stages": validate.Stages,
+	"validate-alt":    validate.Alt,
+}
+
+func openStore(path string) *store.Store {
+	if path == "" {
+		return nil
+	}
+	st, err := store.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return st
+}
+
+// resultVersions name the output of each analysis whose results are
+// kept in the store, as translate.Version does for translations. Bump
+// one whenever the analysis, or the vendored parser it relies on, changes
+// what it returns, so that stale results are computed again.
+var resultVersions = map[string]string{
+	"ast":             "2",
+	"validate-ast":    "1",
+	"validate-stages": "1",
+	"validate-alt":    "1",
+	"stats":           "2",
+	"failures":        "2",
+	"coverage":        "2",
+	"bases":           "2",
+	"dedup":           "4",
+	"cluster":         "1",
+	"features":        "2",
+	"vectors":         "2",
+	"llb-stats":       "1",
+}
+
+// bucket names where the results of an analysis are stored, by its
+// version and by the options that change its results, such as build
+// args.
+func bucket(name string, options ...string) string {
+	v, ok := resultVersions[name]
+	if !ok {
+		panic("no result version for " + name)
+	}
+	return strings.Join(append([]string{name, v}, options...), "/")
+}
+
+// buildArgsOption is the bucket option of a set of build args, empty
+// when there are none.
+func buildArgsOption(args map[string]string) []string {
+	if len(args) == 0 {
+		return nil
+	}
+	pairs := []string{}
+	for k, v := range args {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return []string{"args=" + digest.FromString(strings.Join(pairs, "\n")).Encoded()[:12]}
+}
+
+func addStoreFlag(fs *flag.FlagSet) *string {
+	return fs.String("store", "", "reuse and keep results in the store `file`")
+}
+
+// loadStored fills v with the result of compute for rec, unless one is
+// kept in bucket, and reports whether it was.
+func loadStored(st *store.Store, bucket string, rec *corpus.Record, v interface{}, compute func() error) bool {
+	if st == nil {
+		// spare hashing the contents
+		if err := compute(); err != nil {
+			log.Fatal(err)
+		}
+		return false
+	}
+	d, _, err := st.Add(rec.Id, rec.Contents)
+	if err != nil {
+		log.Fatal(err)
+	}
+	hit, err := st.Load(bucket, d, v, compute)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return hit
+}
+
+// validation is how a check is stored.
+type validation struct {
+	Error string `json:"error,omitempty"`
+}
+
+// validateStored runs check on rec unless its result is stored, and
+// returns whether it was, and the error check found.
+func validateStored(st *store.Store, name string, check validate.Func, rec *corpus.Record) (bool, error) {
+	v := &validation{}
+	hit := loadStored(st, bucket(name), rec, v, func() error {
+		if err := check(strings.NewReader(rec.Contents)); err != nil {
+			v.Error = err.Error()
+		}
+		return nil
+	})
+	if v.Error == "" {
+		return hit, nil
+	}
+	return hit, validationError(v.Error)
+}
+
+type validationError string
+
+func (e validationError) Error() string { return string(e) }
+
+// translateStored translates rec unless its translation by this version
+// of the translator is stored.
+func translateStored(st *store.Store, rec *corpus.Record, annotate bool) (*translate.Record, bool) {
+	bucket := "translate/" + translate.Version
+	if annotate {
+		bucket += "/annotate"
+	}
+	t := &translate.Record{}
+	hit := loadStored(st, bucket, rec, t, func() error {
+		*t = *translate.Translate("", strings.NewReader(rec.Contents), annotate)
+		return nil
+	})
+	return t.WithId(rec.Id), hit
+}
+
+// parsed is how a parse tree is stored.
+type parsed struct {
+	Node   *parser.Node `json:"node,omitempty"`
+	Escape rune         `json:"escape,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// parseStored parses rec unless its parse tree is stored, and returns
+// the tree, whether it was stored, and the error parsing found.
+func parseStored(st *store.Store, rec *corpus.Record) (*parser.Result, bool, error) {
+	p := &parsed{}
+	hit := loadStored(st, bucket("ast"), rec, p, func() error {
+		res, err := parser.Parse(strings.NewReader(rec.Contents))
+		if err != nil {
+			p.Error = err.Error()
+			return nil
+		}
+		p.Node, p.Escape = res.AST, res.EscapeToken
+		return nil
+	})
+	if p.Error != "" {
+		return nil, hit, validationError(p.Error)
+	}
+	return &parser.Result{AST: p.Node, EscapeToken: p.Escape}, hit, nil
+}
+
+// indexMain stores the corpus and the results of parsing, validating and
+// translating each record, skipping the work already stored for
+// unchanged records.
+func indexMain(args []string) {
+	path, jobs := "", 0
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	fs.StringVar(&path, "store", "buildahfy.db", "store `file`")
+	fs.IntVar(&jobs, "j", runtime.NumCPU(), "number of records to process in parallel")
+	in := addInputFlags(fs)
+	fs.Parse(args)
+	st := openStore(path)
+	defer st.Close()
+
+	type indexed struct {
+		changed bool
+		misses  int
+	}
+	records, changed, misses := 0, 0, 0
+	index := func(rec *corpus.Record) interface{} {
+		_, isNew, err := st.Add(rec.Id, rec.Contents)
+		if err != nil {
+			log.Fatal(err)
+		}
+		res := &indexed{changed: isNew}
+		count := func(hit bool) {
+			if !hit {
+				res.misses++
+			}
+		}
+		_, hit, _ := parseStored(st, rec)
+		count(hit)
+		for name, check := range validations {
+			hit, _ := validateStored(st, name, check, rec)
+			count(hit)
+		}
+		_, hit = translateStored(st, rec, false)
+		count(hit)
+		return res
+	}
+	emit := func(rec *corpus.Record, res interface{}) error {
+		records++
+		if res.(*indexed).changed {
+			changed++
+		}
+		misses += res.(*indexed).misses
+		return nil
+	}
+	if err := in.mapRecords(nil, jobs, index, emit); err != nil {
+		mapFailed(err)
+	}
+	log.Printf("%d records, %d new or changed, %d results computed", records, changed, misses)
+}
+
+// inspectMain prints everything stored about one record.
+func inspectMain(args []string) {
+	path := ""
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	fs.StringVar(&path, "store", "buildahfy.db", "store `file`")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("usage: buildahfy inspect [-store file] <id>")
+	}
+	st := openStore(path)
+	defer st.Close()
+	e, err := st.Inspect(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(e); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// gcMain deletes the contents no record has anymore and the results of
+// old versions of the analyses.
+func gcMain(args []string) {
+	path := ""
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	fs.StringVar(&path, "store", "buildahfy.db", "store `file`")
+	fs.Parse(args)
+	st := openStore(path)
+	defer st.Close()
+	contents, buckets, err := st.GC(staleBucket)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("deleted %d contents and %d buckets of old results", contents, buckets)
+}
+
+// staleBucket reports whether a bucket holds results of an analysis, or
+// of one it builds on such as translate=<version>, that are not of the
+// current version.
+func staleBucket(name string) bool {
+	current := func(analysis string) (string, bool) {
+		if analysis == "translate" {
+			return translate.Version, true
+		}
+		v, ok := resultVersions[analysis]
+		return v, ok
+	}
+	parts := strings.Split(name, "/")
+	if v, ok := current(parts[0]); !ok || len(parts) < 2 || parts[1] != v {
+		return true
+	}
+	for _, option := range parts[2:] {
+		kv := strings.SplitN(option, "=", 2)
+		if v, ok := current(kv[0]); ok && len(kv) == 2 && kv[1] != v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,248 @@
+// Package store keeps corpus records and the results of analysing them
+// in a bbolt database, so later runs only process new or changed
+// Dockerfiles.
+//
+// Records are indexed by Id and by the digest of their contents, and
+// results are keyed by digest: records with the same contents share
+// them.
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// bucketIds maps an Id to the digest of its contents.
+	bucketIds = []byte("ids")
+	// bucketDigests holds "<digest> <id>" keys, listing the Ids with
+	// each contents.
+	bucketDigests = []byte("digests")
+	// bucketContents maps a digest to the Dockerfile.
+	bucketContents = []byte("contents")
+)
+
+// Store is a corpus database. A nil *Store stores nothing: Load always
+// computes.
+type Store struct {
+	db *bolt.DB
+}
+
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// Add records the contents of the record with the given Id and returns
+// their digest, and whether they are new for the Id.
+func (s *Store) Add(id, contents string) (digest.Digest, bool, error) {
+	d := digest.FromString(contents)
+	if s == nil {
+		return d, true, nil
+	}
+	unchanged := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(bucketIds); b != nil {
+			unchanged = string(b.Get([]byte(id))) == d.String()
+		}
+		return nil
+	})
+	if err != nil || unchanged {
+		return d, false, err
+	}
+	err = s.db.Batch(func(tx *bolt.Tx) error {
+		ids, err := tx.CreateBucketIfNotExists(bucketIds)
+		if err != nil {
+			return err
+		}
+		digests, err := tx.CreateBucketIfNotExists(bucketDigests)
+		if err != nil {
+			return err
+		}
+		blobs, err := tx.CreateBucketIfNotExists(bucketContents)
+		if err != nil {
+			return err
+		}
+		if old := ids.Get([]byte(id)); old != nil {
+			if err := digests.Delete(digestKey(string(old), id)); err != nil {
+				return err
+			}
+		}
+		if err := ids.Put([]byte(id), []byte(d.String())); err != nil {
+			return err
+		}
+		if err := digests.Put(digestKey(d.String(), id), nil); err != nil {
+			return err
+		}
+		return blobs.Put([]byte(d.String()), []byte(contents))
+	})
+	return d, true, err
+}
+
+func digestKey(d, id string) []byte {
+	return []byte(d + " " + id)
+}
+
+// Load fills v with the result stored in bucket for the contents with
+// digest d. If there is none, it calls compute to fill v and stores the
+// result. It reports whether the result was stored before.
+func (s *Store) Load(bucket string, d digest.Digest, v interface{}, compute func() error) (bool, error) {
+	if s == nil {
+		return false, compute()
+	}
+	var dt []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(bucket)); b != nil {
+			dt = append([]byte{}, b.Get([]byte(d.String()))...)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	if len(dt) > 0 {
+		return true, json.Unmarshal(dt, v)
+	}
+	if err := compute(); err != nil {
+		return false, err
+	}
+	if dt, err = json.Marshal(v); err != nil {
+		return false, err
+	}
+	return false, s.db.Batch(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(d.String()), dt)
+	})
+}
+
+// Entry is everything the store knows about one Id.
+type Entry struct {
+	Id     string        `json:"id"`
+	Digest digest.Digest `json:"digest"`
+	// Ids are all the records with the same contents.
+	Ids      []string `json:"ids"`
+	Contents string   `json:"contents"`
+	// Results are keyed by bucket, such as "ast/1" or "translate/1".
+	Results map[string]json.RawMessage `json:"results"`
+}
+
+// Inspect returns what is stored for an Id.
+func (s *Store) Inspect(id string) (*Entry, error) {
+	e := &Entry{Id: id, Ids: []string{}, Results: map[string]json.RawMessage{}}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		ids := tx.Bucket(bucketIds)
+		if ids == nil || ids.Get([]byte(id)) == nil {
+			return errors.Errorf("%s is not in the store", id)
+		}
+		e.Digest = digest.Digest(ids.Get([]byte(id)))
+		key := []byte(e.Digest.String())
+		if b := tx.Bucket(bucketDigests); b != nil {
+			prefix := digestKey(e.Digest.String(), "")
+			c := b.Cursor()
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				e.Ids = append(e.Ids, string(k[len(prefix):]))
+			}
+		}
+		if b := tx.Bucket(bucketContents); b != nil {
+			e.Contents = string(b.Get(key))
+		}
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			switch {
+			case bytes.Equal(name, bucketIds), bytes.Equal(name, bucketDigests), bytes.Equal(name, bucketContents):
+				return nil
+			}
+			if v := b.Get(key); v != nil {
+				e.Results[string(name)] = append(json.RawMessage{}, v...)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// GC deletes what the store keeps to no use: the contents that no Id
+// has anymore, with their results, and the buckets that stale reports to
+// hold the results of an old version of an analysis. It returns how many
+// contents and buckets it deleted.
+func (s *Store) GC(stale func(bucket string) bool) (int, int, error) {
+	contents, buckets := 0, 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		live := map[string]bool{}
+		if b := tx.Bucket(bucketIds); b != nil {
+			if err := b.ForEach(func(_, d []byte) error {
+				live[string(d)] = true
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		names := [][]byte{}
+		if err := tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			names = append(names, append([]byte{}, name...))
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, name := range names {
+			switch {
+			case bytes.Equal(name, bucketIds), bytes.Equal(name, bucketDigests):
+				continue
+			case !bytes.Equal(name, bucketContents) && stale(string(name)):
+				if err := tx.DeleteBucket(name); err != nil {
+					return err
+				}
+				buckets++
+				continue
+			}
+			n, err := deleteDead(tx.Bucket(name), live)
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(name, bucketContents) {
+				contents = n
+			}
+		}
+		return nil
+	})
+	return contents, buckets, err
+}
+
+// deleteDead deletes the keys of b that are not live digests.
+func deleteDead(b *bolt.Bucket, live map[string]bool) (int, error) {
+	dead := [][]byte{}
+	if err := b.ForEach(func(k, _ []byte) error {
+		if !live[string(k)] {
+			dead = append(dead, append([]byte{}, k...))
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	for _, k := range dead {
+		if err := b.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	return len(dead), nil
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func open(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(filepath.Join(dir, "test.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// load loads the length of contents from bucket, and reports whether it
+// was stored.
+func load(t *testing.T, s *Store, bucket, id, contents string) bool {
+	d, _, err := s.Add(id, contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	hit, err := s.Load(bucket, d, &n, func() error {
+		n = len(contents)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(contents) {
+		t.Fatalf("loaded %d for %q", n, contents)
+	}
+	return hit
+}
+
+func TestRoundTrip(t *testing.T) {
+	s, cleanup := open(t)
+	defer cleanup()
+
+	if load(t, s, "len/1", "a", "FROM alpine\n") {
+		t.Error("a result was stored before it was computed")
+	}
+	if !load(t, s, "len/1", "a", "FROM alpine\n") {
+		t.Error("the result of a was not stored")
+	}
+	// the same contents share the result
+	if !load(t, s, "len/1", "b", "FROM alpine\n") {
+		t.Error("b does not share the result of a")
+	}
+	e, err := s.Inspect("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(e.Ids, " ") != "a b" || e.Contents != "FROM alpine\n" || string(e.Results["len/1"]) != "12" {
+		t.Errorf("inspected %+v", e)
+	}
+	if _, isNew, _ := s.Add("a", "FROM alpine\n"); isNew {
+		t.Error("unchanged contents count as new")
+	}
+}
+
+func TestGC(t *testing.T) {
+	s, cleanup := open(t)
+	defer cleanup()
+
+	load(t, s, "len/1", "a", "FROM alpine\n")
+	load(t, s, "len/2", "a", "FROM alpine\n")
+	load(t, s, "len/1", "a", "FROM debian\n")
+	load(t, s, "len/2", "a", "FROM debian\n")
+	contents, buckets, err := s.GC(func(bucket string) bool { return bucket == "len/1" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contents != 1 || buckets != 1 {
+		t.Errorf("deleted %d contents and %d buckets, want the alpine contents and len/1", contents, buckets)
+	}
+	e, err := s.Inspect("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Contents != "FROM debian\n" || len(e.Results) != 1 || e.Results["len/2"] == nil {
+		t.Errorf("inspected %+v after gc", e)
+	}
+	if load(t, s, "len/2", "c", "FROM alpine\n") {
+		t.Error("the result of the deleted contents is still stored")
+	}
+}
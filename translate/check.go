@@ -0,0 +1,87 @@
+package translate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/step"
+	"github.com/moby/buildkit/frontend/dockerfile/command"
+)
+
+// Status says how faithfully an instruction was translated.
+type Status string
+
+const (
+	// Translated instructions became a buildah command.
+	Translated Status = "translated"
+	// Placeholder instructions have no buildah equivalent and were
+	// written as a comment.
+	Placeholder Status = "placeholder"
+	// Unsupported instructions were translated with some flags dropped.
+	Unsupported Status = "unsupported"
+	// Panicked instructions crashed the translator.
+	Panicked Status = "panicked"
+)
+
+// supportedFlags lists the flags whose meaning the translation carries
+// over, by instruction.
+var supportedFlags = map[string]map[string]bool{
+	command.Add:         {"chown": true},
+	command.Copy:        {"from": true, "chown": true},
+	command.Healthcheck: {"interval": true, "timeout": true, "start-period": true, "retries": true},
+}
+
+// Outcome is the result of translating one step.
+type Outcome struct {
+	Status  Status
+	Command string
+	// Flags are the names of the flags of the instruction, such as
+	// "--mount", and Dropped those the translation ignores.
+	Flags   []string
+	Dropped []string
+	Panic   string
+}
+
+// Check translates s and reports how it went.
+func Check(s step.Step) (out Outcome) {
+	for _, flag := range s.Node.Flags {
+		name := strings.SplitN(flag, "=", 2)[0]
+		out.Flags = append(out.Flags, name)
+		if !supportedFlags[s.Node.Value][strings.TrimPrefix(name, "--")] {
+			out.Dropped = append(out.Dropped, name)
+		}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			out.Status, out.Panic = Panicked, fmt.Sprint(r)
+		}
+	}()
+	cmd, ok := translateInstruction(s.Instruction)
+	if !ok {
+		// every instruction has a translation; one without counts as a
+		// crash
+		panic("no translation for " + strings.ToUpper(s.Node.Value))
+	}
+	out.Command = cmd
+	switch {
+	case strings.HasPrefix(cmd, "#"):
+		out.Status = Placeholder
+	case len(out.Dropped) > 0:
+		out.Status = Unsupported
+	default:
+		out.Status = Translated
+	}
+	return out
+}
+
+// StatusOf returns the status Translate gives a Dockerfile parsed into
+// steps, that of its worst step, without writing the script.
+func StatusOf(steps []step.Step) Status {
+	status := Translated
+	for _, s := range steps {
+		if out := Check(s); out.Status.Worse(status) {
+			status = out.Status
+		}
+	}
+	return status
+}
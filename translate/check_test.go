@@ -0,0 +1,39 @@
+package translate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/btwiuse/buildahfy/step"
+)
+
+func TestCheck(t *testing.T) {
+	steps, err := step.Parse(strings.NewReader(`FROM --platform=linux/arm64 alpine AS build
+ARG V=1
+RUN apk add curl
+COPY --from=build --chown=1:1 /a /b
+HEALTHCHECK --interval=5s --start-period=1s CMD true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		status  Status
+		dropped string
+	}{
+		{Unsupported, "--platform"},
+		{Placeholder, ""},
+		{Translated, ""},
+		{Translated, ""},
+		{Translated, ""},
+	}
+	for i, s := range steps {
+		out := Check(s)
+		if out.Status != want[i].status || strings.Join(out.Dropped, " ") != want[i].dropped {
+			t.Errorf("line %d: %s dropping %q, want %s dropping %q", s.Node.StartLine, out.Status, out.Dropped, want[i].status, want[i].dropped)
+		}
+		if out.Command == "" {
+			t.Errorf("line %d: no command", s.Node.StartLine)
+		}
+	}
+}
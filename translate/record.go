@@ -0,0 +1,134 @@
+package translate
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/step"
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+)
+
+// Failed is the status of a Dockerfile that does not parse.
+const Failed Status = "failed"
+
+// Version names the output of the translator. Bump it whenever
+// translations change, so that stored translations are redone.
+const Version = "1"
+
+// severity orders statuses from best to worst; a record has the status
+// of its worst step.
+var severity = map[Status]int{
+	Translated:  0,
+	Placeholder: 1,
+	Unsupported: 2,
+	Panicked:    3,
+	Failed:      4,
+}
+
+// Worse reports whether s is a worse outcome than t.
+func (s Status) Worse(t Status) bool {
+	return severity[s] > severity[t]
+}
+
+// Record is the translation of one Dockerfile in a form meant for
+// machines: one JSON object per corpus record.
+type Record struct {
+	Id          string       `json:"id"`
+	Status      Status       `json:"status"`
+	Script      string       `json:"script"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+	Stages      []Stage      `json:"stages"`
+	// SourceMap maps lines of Script back to the Dockerfile.
+	SourceMap []Mapping `json:"sourceMap"`
+}
+
+// Diagnostic reports a step that did not translate cleanly, or why the
+// whole file failed, in which case Line may be 0.
+type Diagnostic struct {
+	Line        int    `json:"line"`
+	Instruction string `json:"instruction,omitempty"`
+	Status      Status `json:"status"`
+	Message     string `json:"message"`
+}
+
+// Stage summarizes one build stage.
+type Stage struct {
+	Name         string `json:"name,omitempty"`
+	Base         string `json:"base"`
+	Line         int    `json:"line"`
+	Instructions int    `json:"instructions"`
+}
+
+// Translate translates the Dockerfile read from r, writing each
+// instruction as a comment above its translation if annotate is set.
+func Translate(id string, r io.Reader, annotate bool) *Record {
+	rec := &Record{Id: id, Status: Translated, Diagnostics: []Diagnostic{}, Stages: []Stage{}, SourceMap: []Mapping{}}
+	dt, err := ioutil.ReadAll(r)
+	if err != nil {
+		rec.fail(err)
+		return rec
+	}
+	buf := &bytes.Buffer{}
+	sc := NewScript(buf)
+	sc.Annotate = annotate
+	steps, err := sc.steps(id, dt, func(s step.Step) string {
+		out := Check(s)
+		if out.Status != Translated {
+			rec.diagnose(s, out)
+		}
+		return out.Command
+	})
+	if err != nil {
+		rec.fail(err)
+		return rec
+	}
+	rec.Script = buf.String()
+	rec.SourceMap = sc.SourceMap.Mappings
+	_, stages := step.Stages(steps)
+	for _, st := range stages {
+		stage := st[0].Instruction.(*instructions.Stage)
+		rec.Stages = append(rec.Stages, Stage{
+			Name:         stage.Name,
+			Base:         stage.BaseName,
+			Line:         st[0].Node.StartLine,
+			Instructions: len(st) - 1,
+		})
+	}
+	return rec
+}
+
+// WithId returns a copy of rec for another record with the same
+// contents.
+func (rec *Record) WithId(id string) *Record {
+	c := *rec
+	c.Id = id
+	c.SourceMap = []Mapping{}
+	for _, m := range rec.SourceMap {
+		m.Id = id
+		c.SourceMap = append(c.SourceMap, m)
+	}
+	return &c
+}
+
+func (rec *Record) fail(err error) {
+	rec.Status = Failed
+	rec.Diagnostics = append(rec.Diagnostics, Diagnostic{Status: Failed, Message: err.Error()})
+}
+
+func (rec *Record) diagnose(s step.Step, out Outcome) {
+	d := Diagnostic{Line: s.Node.StartLine, Instruction: s.Source(), Status: out.Status}
+	switch out.Status {
+	case Placeholder:
+		d.Message = "no buildah equivalent, written as a comment"
+	case Unsupported:
+		d.Message = "dropped " + strings.Join(out.Dropped, " ")
+	case Panicked:
+		d.Message = "translator panicked: " + out.Panic
+	}
+	rec.Diagnostics = append(rec.Diagnostics, d)
+	if out.Status.Worse(rec.Status) {
+		rec.Status = out.Status
+	}
+}
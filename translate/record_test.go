@@ -0,0 +1,63 @@
+package translate
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTranslateRecord(t *testing.T) {
+	dt := "FROM --platform=linux/amd64 golang AS build\nARG VERSION\nRUN make\nFROM alpine\nCOPY --from=build /a /a\n"
+	rec := Translate("x", strings.NewReader(dt), false)
+	if rec.Status != Unsupported {
+		t.Errorf("status %s, want that of the worst step", rec.Status)
+	}
+	want := []Diagnostic{
+		{Line: 1, Instruction: "FROM --platform=linux/amd64 golang AS build", Status: Unsupported, Message: "dropped --platform"},
+		{Line: 2, Instruction: "ARG VERSION", Status: Placeholder, Message: "no buildah equivalent, written as a comment"},
+	}
+	if !reflect.DeepEqual(rec.Diagnostics, want) {
+		t.Errorf("diagnostics %+v, want %+v", rec.Diagnostics, want)
+	}
+	stages := []Stage{
+		{Name: "build", Base: "golang", Line: 1, Instructions: 2},
+		{Base: "alpine", Line: 4, Instructions: 1},
+	}
+	if !reflect.DeepEqual(rec.Stages, stages) {
+		t.Errorf("stages %+v, want %+v", rec.Stages, stages)
+	}
+	if n := strings.Count(rec.Script, "\n"); n != 5 || len(rec.SourceMap) != 5 || rec.SourceMap[4].Id != "x" {
+		t.Errorf("%d script lines and source map %+v", n, rec.SourceMap)
+	}
+
+	other := rec.WithId("y")
+	if other.Id != "y" || other.SourceMap[0].Id != "y" || rec.SourceMap[0].Id != "x" {
+		t.Error("WithId does not rename the copy alone")
+	}
+}
+
+func TestTranslateRecordFailed(t *testing.T) {
+	rec := Translate("x", strings.NewReader("FROM alpine\nFOO bar\n"), true)
+	dt, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a failed record still has every field, empty, for consumers that
+	// expect them
+	got := map[string]interface{}{}
+	if err := json.Unmarshal(dt, &got); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"id", "status", "script", "diagnostics", "stages", "sourceMap"} {
+		if _, ok := got[key]; !ok {
+			t.Errorf("no %s in %s", key, dt)
+		}
+	}
+	if rec.Status != Failed || len(rec.Diagnostics) != 1 || !strings.Contains(rec.Diagnostics[0].Message, "line 2") {
+		t.Errorf("record %s, want a failure at line 2", dt)
+	}
+	if rec.Stages == nil || len(rec.Stages) != 0 || rec.Script != "" {
+		t.Errorf("record %s, want no stages or script", dt)
+	}
+}
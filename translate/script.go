@@ -0,0 +1,110 @@
+package translate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/step"
+)
+
+var utf8bom = []byte{0xEF, 0xBB, 0xBF}
+
+// Script writes buildah scripts for Dockerfiles and keeps a source map
+// of the lines it has written.
+type Script struct {
+	// Annotate writes each instruction as a comment above its
+	// translation.
+	Annotate  bool
+	SourceMap SourceMap
+
+	w     io.Writer
+	lines int
+}
+
+func NewScript(w io.Writer) *Script {
+	return &Script{w: w, SourceMap: SourceMap{Mappings: []Mapping{}}}
+}
+
+// Println writes s and a newline, counting the lines written.
+func (sc *Script) Println(s string) {
+	fmt.Fprintln(sc.w, s)
+	sc.lines += strings.Count(s, "\n") + 1
+}
+
+// Splice writes text, the output of part, and takes over the source map
+// of part, shifted past the lines already written. It lets records be
+// translated concurrently into their own scripts and joined in order.
+func (sc *Script) Splice(part *Script, text []byte) {
+	sc.w.Write(text)
+	for _, m := range part.SourceMap.Mappings {
+		m.Output[0] += sc.lines
+		m.Output[1] += sc.lines
+		sc.SourceMap.Mappings = append(sc.SourceMap.Mappings, m)
+	}
+	sc.lines += part.lines
+}
+
+// Dockerfile translates the Dockerfile read from r. id names the record
+// in the source map and may be empty.
+func (sc *Script) Dockerfile(id string, r io.Reader) error {
+	dt, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	_, err = sc.steps(id, dt, func(s step.Step) string {
+		return Instruction(s.Instruction)
+	})
+	return err
+}
+
+// steps writes the translation of each step of the Dockerfile in dt, as
+// made by translate, and returns the steps.
+func (sc *Script) steps(id string, dt []byte, translate func(step.Step) string) ([]step.Step, error) {
+	steps, err := step.Parse(bytes.NewReader(dt))
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(bytes.TrimPrefix(dt, utf8bom)), "\n")
+	for _, s := range steps {
+		first := sc.lines + 1
+		if sc.Annotate {
+			for _, line := range lines[s.Node.StartLine-1 : s.Node.EndLine] {
+				sc.Println("# " + strings.TrimRight(line, "\r"))
+			}
+		}
+		if line := translate(s); line != "" {
+			sc.Println(line)
+		}
+		if sc.lines >= first {
+			sc.SourceMap.add(id, first, sc.lines, s)
+		}
+	}
+	return steps, nil
+}
+
+// SourceMap maps line ranges of the generated script back to the
+// Dockerfile lines they were translated from. Ranges are 1-based and
+// inclusive.
+type SourceMap struct {
+	Mappings []Mapping `json:"mappings"`
+}
+
+type Mapping struct {
+	// Id is the corpus record the instruction came from, if any.
+	Id          string `json:"id,omitempty"`
+	Output      [2]int `json:"output"`
+	Source      [2]int `json:"source"`
+	Instruction string `json:"instruction"`
+}
+
+func (m *SourceMap) add(id string, first, last int, s step.Step) {
+	m.Mappings = append(m.Mappings, Mapping{
+		Id:          id,
+		Output:      [2]int{first, last},
+		Source:      [2]int{s.Node.StartLine, s.Node.EndLine},
+		Instruction: s.Source(),
+	})
+}
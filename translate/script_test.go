@@ -0,0 +1,79 @@
+package translate
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// dockerfile starts with a byte order mark and continues a RUN over two
+// CRLF lines.
+const dockerfile = "\xEF\xBB\xBFFROM alpine\r\nRUN apk add \\\r\n  curl\r\nHEALTHCHECK NONE\r\n"
+
+func TestScriptSourceMap(t *testing.T) {
+	buf := &bytes.Buffer{}
+	sc := NewScript(buf)
+	sc.Annotate = true
+	if err := sc.Dockerfile("a", strings.NewReader(dockerfile)); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	want := []Mapping{
+		{Id: "a", Output: [2]int{1, 2}, Source: [2]int{1, 1}, Instruction: "FROM alpine"},
+		{Id: "a", Output: [2]int{3, 5}, Source: [2]int{2, 3}, Instruction: "RUN apk add   curl"},
+		{Id: "a", Output: [2]int{6, 7}, Source: [2]int{4, 4}, Instruction: "HEALTHCHECK NONE"},
+	}
+	if !reflect.DeepEqual(sc.SourceMap.Mappings, want) {
+		t.Fatalf("source map %+v, want %+v", sc.SourceMap.Mappings, want)
+	}
+	// each range starts with the annotation of its source lines, with
+	// the byte order mark and carriage returns dropped
+	if lines[0] != "# FROM alpine" || lines[2] != `# RUN apk add \` || lines[3] != "#   curl" || lines[5] != "# HEALTHCHECK NONE" {
+		t.Errorf("annotations %q", lines)
+	}
+	if len(lines) != 7 {
+		t.Errorf("%d lines, want 7:\n%s", len(lines), buf)
+	}
+}
+
+func TestScriptUnannotated(t *testing.T) {
+	buf := &bytes.Buffer{}
+	sc := NewScript(buf)
+	if err := sc.Dockerfile("", strings.NewReader("FROM alpine\nARG x\nRUN true\n")); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(buf.String(), "\n") != 3 {
+		t.Errorf("got\n%s\nwant one line per instruction", buf)
+	}
+	for _, m := range sc.SourceMap.Mappings {
+		if m.Output[0] != m.Output[1] || m.Output[0] != m.Source[0] || m.Id != "" {
+			t.Errorf("mapping %+v, want each line to map to itself", m)
+		}
+	}
+}
+
+func TestSplice(t *testing.T) {
+	parts := []string{"FROM a\nRUN one\n", "FROM b\nARG x\nRUN two\n"}
+	buf := &bytes.Buffer{}
+	sc := NewScript(buf)
+	for i, dt := range parts {
+		text := &bytes.Buffer{}
+		part := NewScript(text)
+		part.Annotate = true
+		if err := part.Dockerfile(string('a'+rune(i)), strings.NewReader(dt)); err != nil {
+			t.Fatal(err)
+		}
+		sc.Splice(part, text.Bytes())
+	}
+	lines := strings.Split(buf.String(), "\n")
+	for _, m := range sc.SourceMap.Mappings {
+		// the annotation of each mapping is the first of its lines
+		if got := lines[m.Output[0]-1]; got != "# "+m.Instruction {
+			t.Errorf("%s: output line %d is %q", m.Id, m.Output[0], got)
+		}
+	}
+	if n := len(sc.SourceMap.Mappings); n != 5 {
+		t.Errorf("%d mappings, want 5", n)
+	}
+}
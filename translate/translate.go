@@ -0,0 +1,273 @@
+// Package translate turns Dockerfile instructions into buildah commands.
+package translate
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/btwiuse/pretty"
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/pkg/errors"
+)
+
+// Instruction returns the buildah command for a single instruction, or
+// "" if there is none.
+func Instruction(ins interface{}) string {
+	cmd, ok := translateInstruction(ins)
+	if !ok {
+		log.Println(ins.(instructions.Command).Name())
+	}
+	return cmd
+}
+
+// translateInstruction is Instruction without the logging; ok is false
+// for commands without a translation of their own.
+func translateInstruction(ins interface{}) (cmd string, ok bool) {
+	switch c := ins.(type) {
+	case *instructions.ArgCommand:
+		return translateArgCommand(c), true
+	case *instructions.VolumeCommand:
+		return translateVolumeCommand(c), true
+	case *instructions.OnbuildCommand:
+		return translateOnbuildCommand(c), true
+	case *instructions.AddCommand:
+		return translateAddCommand(c), true
+	case *instructions.CopyCommand:
+		return translateCopyCommand(c), true
+	case *instructions.HealthCheckCommand:
+		return translateHealthCheckCommand(c), true
+	case *instructions.RunCommand:
+		return translateRunCommand(c), true
+	case *instructions.LabelCommand:
+		return translateLabelCommand(c), true
+	case *instructions.MaintainerCommand:
+		return translateMaintainerCommand(c), true
+	case *instructions.ShellCommand:
+		return translateShellCommand(c), true
+	case *instructions.CmdCommand:
+		return translateCmdCommand(c), true
+	case *instructions.EntrypointCommand:
+		return translateEntrypointCommand(c), true
+	case *instructions.WorkdirCommand:
+		return translateWorkdirCommand(c), true
+	case *instructions.ExposeCommand:
+		return translateExposeCommand(c), true
+	case *instructions.StopSignalCommand:
+		return translateStopSignalCommand(c), true
+	case *instructions.UserCommand:
+		return translateUserCommand(c), true
+	case *instructions.EnvCommand:
+		return translateEnvCommand(c), true
+	case *instructions.Stage: // from command
+		return translateStage(c), true
+	case instructions.Command: // ADD ARG CMD COPY ENTRYPOINT ENV EXPOSE HEALTHCHECK LABEL MAINTAINER ONBUILD RUN SHELL STOPSIGNAL USER VOLUME WORKDIR
+		return "", false
+	default:
+		panic(errors.Errorf("%s", "unknown message"))
+	}
+}
+
+func translateStage(c *instructions.Stage) string {
+	if c.Name == "" {
+		return "buildah from " + c.BaseName
+	}
+	return "buildah from --name " + c.Name + " " + c.BaseName
+}
+
+func translateArgCommand(c *instructions.ArgCommand) string {
+	base := "# buildah config %s <container>"
+	arg := ""
+	kv := c.KeyValuePairOptional
+	if kv.Value == nil {
+		arg = fmt.Sprintf("--arg %s", kv.Key)
+	} else {
+		arg = fmt.Sprintf("--arg %s=%s", kv.Key, *kv.Value)
+	}
+	return fmt.Sprintf(base, arg)
+}
+
+func translateVolumeCommand(c *instructions.VolumeCommand) string {
+	base := "buildah config %s <container>"
+	vols := []string{}
+	for _, vol := range c.Volumes {
+		vols = append(vols, fmt.Sprintf("--volume %s", vol))
+	}
+	return fmt.Sprintf(base, strings.Join(vols, " "))
+}
+
+func translateOnbuildCommand(c *instructions.OnbuildCommand) string {
+	base := "buildah config %s <container>"
+	onbuild := fmt.Sprintf("--onbuild '%s'", c.Expression)
+	return fmt.Sprintf(base, onbuild)
+}
+
+func translateAddCommand(c *instructions.AddCommand) string {
+	base := "buildah add %s <container> %s"
+	opts := []string{}
+	if c.Chown != "" {
+		opts = append(opts, fmt.Sprintf("--chown %s", c.Chown))
+	}
+	optstr := strings.Join(opts, " ")
+	cp := strings.Join(c.SourcesAndDest, " ")
+	return fmt.Sprintf(base, optstr, cp)
+}
+
+func translateCopyCommand(c *instructions.CopyCommand) string {
+	base := "buildah copy %s <container> %s"
+	opts := []string{}
+	if c.From != "" {
+		opts = append(opts, fmt.Sprintf("--from %s", c.From))
+	}
+	if c.Chown != "" {
+		opts = append(opts, fmt.Sprintf("--chown %s", c.Chown))
+	}
+	optstr := strings.Join(opts, " ")
+	cp := strings.Join(c.SourcesAndDest, " ")
+	return fmt.Sprintf(base, optstr, cp)
+}
+
+// adapted from translateRunCommand
+func translateHealthCheckCommand(c *instructions.HealthCheckCommand) string {
+	base := "buildah config %s <container>"
+	options := []string{}
+	switch c.Health.Test[0] {
+	case "NONE":
+		options = append(options, "--healthcheck NONE")
+	case "CMD":
+		options = append(options, fmt.Sprintf("--healthcheck 'CMD %s'", strings.Join(c.Health.Test[1:], " ")))
+	case "CMD-SHELL":
+		options = append(options, fmt.Sprintf("--healthcheck 'CMD-SHELL %s'", strings.Join(c.Health.Test[1:], " ")))
+	}
+	if retries := c.Health.Retries; retries != 0 {
+		options = append(options, fmt.Sprintf("--healthcheck-retries %d", retries))
+	}
+	if interval := c.Health.Interval; interval != 0 {
+		options = append(options, fmt.Sprintf("--healthcheck-interval %d", int(interval.Seconds())))
+	}
+	if startPeriod := c.Health.StartPeriod; startPeriod != 0 {
+		options = append(options, fmt.Sprintf("--healthcheck-start-period %d", int(startPeriod.Seconds())))
+	}
+	if timeout := c.Health.Timeout; timeout != 0 {
+		options = append(options, fmt.Sprintf("--healthcheck-timeout %d", int(timeout.Seconds())))
+	}
+	opts := fmt.Sprintf(`%s`, strings.Join(options, " "))
+	return fmt.Sprintf(base, opts)
+}
+
+// adapted from translateEntrypointCommand
+// TODO: handle bash ; && ()
+func translateRunCommand(c *instructions.RunCommand) string {
+	base := "buildah run [options] <container> %s"
+	cmd := ""
+	if c.PrependShell {
+		for _, arg := range c.CmdLine {
+			if strings.HasPrefix(arg, "-") {
+				base += " -- "
+			}
+			break
+		}
+		cmd = fmt.Sprintf("/bin/sh -c '%s'", strings.Join(c.CmdLine, " "))
+	} else { // exec form
+		cmd = fmt.Sprintf(`%s`, strings.Join(c.CmdLine, " "))
+	}
+	return fmt.Sprintf(base, cmd)
+}
+
+func translateLabelCommand(c *instructions.LabelCommand) string {
+	base := "buildah config %s <container>"
+	labels := []string{}
+	for _, kv := range c.Labels {
+		label := fmt.Sprintf(`--label %s=%s`, kv.Key, kv.Value)
+		labels = append(labels, label)
+	}
+	return fmt.Sprintf(base, strings.Join(labels, " "))
+}
+
+// TODO: better single/double quote handling
+func translateMaintainerCommand(c *instructions.MaintainerCommand) string {
+	base := "buildah config %s <container>"
+	maintainer := fmt.Sprintf(`--label maintainer='%s'`, c.Maintainer)
+	return fmt.Sprintf(base, maintainer)
+}
+
+// adapted from translateEntrypointCommand
+func translateShellCommand(c *instructions.ShellCommand) string {
+	base := "buildah config %s <container>"
+	shell := fmt.Sprintf(`--shell '%s'`, strings.TrimSpace(pretty.JsonString(c.Shell)))
+	return fmt.Sprintf(base, shell)
+}
+
+// adapted from translateEntrypointCommand
+func translateCmdCommand(c *instructions.CmdCommand) string {
+	base := "buildah config %s <container>"
+	cmd := ""
+	if c.PrependShell {
+		cmd = fmt.Sprintf(`--cmd '%s'`, strings.Join(c.CmdLine, " "))
+	} else {
+		cmdline := []string{}
+		if c.CmdLine != nil {
+			cmdline = c.CmdLine
+		}
+		cmd = fmt.Sprintf(`--cmd '%s'`, strings.TrimSpace(pretty.JsonString(cmdline)))
+	}
+	return fmt.Sprintf(base, cmd)
+}
+
+func translateEntrypointCommand(c *instructions.EntrypointCommand) string {
+	base := "buildah config %s <container>"
+	entrypoint := ""
+	if c.PrependShell {
+		/* ENTRYPOINT # will unset existing entrypoints
+		if len(c.CmdLine) != 1 {
+			log.Println(len(c.CmdLine), globalid, pretty.JsonString(c), fmt.Sprintf("%+q", c.CmdLine)) // all 0
+		} */
+		entrypoint = fmt.Sprintf(`--entrypoint '%s'`, strings.Join(c.CmdLine, " "))
+	} else {
+		cmdline := []string{} // prevent --entrypoint 'null'
+		if c.CmdLine != nil {
+			cmdline = c.CmdLine
+		}
+		entrypoint = fmt.Sprintf(`--entrypoint '%s'`, strings.TrimSpace(pretty.JsonString(cmdline)))
+	}
+	return fmt.Sprintf(base, entrypoint)
+}
+
+func translateWorkdirCommand(c *instructions.WorkdirCommand) string {
+	base := "buildah config %s <container>"
+	workingdir := fmt.Sprintf("--workingdir %s", c.Path)
+	return fmt.Sprintf(base, workingdir)
+}
+
+func translateExposeCommand(c *instructions.ExposeCommand) string {
+	base := "buildah config %s <container>"
+	ports := []string{}
+	for _, port := range c.Ports {
+		port := fmt.Sprintf("--port %s", port)
+		ports = append(ports, port)
+	}
+	return fmt.Sprintf(base, strings.Join(ports, " "))
+}
+
+func translateStopSignalCommand(c *instructions.StopSignalCommand) string {
+	base := "buildah config %s <container>"
+	signal := fmt.Sprintf("--stop-signal %s", c.Signal)
+	return fmt.Sprintf(base, signal)
+}
+
+// TODO: wrap shell variables in single quotes #1250
+func translateUserCommand(c *instructions.UserCommand) string {
+	base := "buildah config %s <container>"
+	user := fmt.Sprintf("--user %s", c.User)
+	return fmt.Sprintf(base, user)
+}
+
+func translateEnvCommand(c *instructions.EnvCommand) string {
+	base := "buildah config %s <container>"
+	envs := []string{}
+	for _, kv := range c.Env {
+		env := fmt.Sprintf("--env %s=%s", kv.Key, kv.Value)
+		envs = append(envs, env)
+	}
+	return fmt.Sprintf(base, strings.Join(envs, " "))
+}
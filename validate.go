@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"runtime"
+
+	"github.com/btwiuse/buildahfy/corpus"
+	"github.com/btwiuse/buildahfy/validate"
+	"github.com/btwiuse/pretty"
+)
+
+// validateMain returns a subcommand that checks every record of the
+// corpus, logging the Id and error of failures and printing the records
+// that pass.
+func validateMain(name string, check validate.Func) func(args []string) {
+	return func(args []string) {
+		jobs := 0
+		fs := flag.NewFlagSet(name, flag.ExitOnError)
+		fs.IntVar(&jobs, "j", runtime.NumCPU(), "number of records to process in parallel")
+		path := addStoreFlag(fs)
+		in := addInputFlags(fs)
+		ck := addCheckpointFlags(fs)
+		fs.Parse(args)
+		defer ck.open()()
+		st := openStore(*path)
+		defer st.Close()
+		checkRecord := func(rec *corpus.Record) interface{} {
+			_, err := validateStored(st, name, check, rec)
+			return err
+		}
+		emit := func(rec *corpus.Record, res interface{}) error {
+			if err, _ := res.(error); err != nil {
+				log.Println(rec.Id, err)
+				return nil
+			}
+			_, err := fmt.Fprint(ck.out, pretty.JsonString(rec.Result))
+			return err
+		}
+		if err := in.mapRecords(ck, jobs, checkRecord, emit); err != nil {
+			mapFailed(err)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Package validate checks corpus Dockerfiles with the available parsers.
+package validate
+
+import (
+	"io"
+
+	"github.com/asottile/dockerfile"
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// Func checks one Dockerfile.
+type Func func(r io.Reader) error
+
+// AST checks that every node of the buildkit parse tree is a valid
+// instruction.
+func AST(r io.Reader) error {
+	ast, err := parser.Parse(r)
+	if err != nil {
+		return err
+	}
+	for _, node := range ast.AST.Children {
+		if _, err := instructions.ParseInstruction(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stages checks that the instructions form valid build stages.
+func Stages(r io.Reader) error {
+	ast, err := parser.Parse(r)
+	if err != nil {
+		return err
+	}
+	_, _, err = instructions.Parse(ast.AST)
+	return err
+}
+
+// Alt checks the Dockerfile with the asottile/dockerfile parser.
+func Alt(r io.Reader) error {
+	_, err := dockerfile.ParseReader(r)
+	return err
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"runtime"
+
+	"github.com/btwiuse/buildahfy/corpus"
+	"github.com/btwiuse/buildahfy/parserdiff"
+	"github.com/btwiuse/pretty"
+)
+
+// validateDiffMain runs both Dockerfile parsers on every record of the
+// corpus and prints the records they disagree on, minimized, as a
+// corpus stream annotated with the disagreement.
+func validateDiffMain(args []string) {
+	minimize, jobs := true, 0
+	fs := flag.NewFlagSet("validate-diff", flag.ExitOnError)
+	fs.BoolVar(&minimize, "minimize", true, "reduce each disagreeing Dockerfile to the lines that keep the disagreement")
+	fs.IntVar(&jobs, "j", runtime.NumCPU(), "number of records to process in parallel")
+	in := addInputFlags(fs)
+	ck := addCheckpointFlags(fs)
+	fs.Parse(args)
+	defer ck.open()()
+
+	type testCase struct {
+		corpus.Result
+		*parserdiff.Diff
+	}
+	records, cases := 0, 0
+	compare := func(rec *corpus.Record) interface{} {
+		dt := []byte(rec.Contents)
+		d := parserdiff.Compare(dt)
+		if d == nil {
+			return (*testCase)(nil)
+		}
+		if minimize {
+			dt = parserdiff.Minimize(dt, d)
+			d = parserdiff.Compare(dt)
+		}
+		value, err := json.Marshal(&corpus.Response{Contents: string(dt)})
+		if err != nil {
+			panic(err)
+		}
+		return &testCase{corpus.Result{Id: rec.Id, Value: string(value)}, d}
+	}
+	emit := func(rec *corpus.Record, res interface{}) error {
+		records++
+		tc := res.(*testCase)
+		if tc == nil {
+			return nil
+		}
+		cases++
+		_, err := ck.out.WriteString(pretty.JsonString(tc))
+		return err
+	}
+	if err := in.mapRecords(ck, jobs, compare, emit); err != nil {
+		mapFailed(err)
+	}
+	log.Printf("%d records, %d disagree", records, cases)
+}
@@ -0,0 +1,236 @@
+// Package vector flattens each Dockerfile into a row of the same
+// columns, so that a corpus can be loaded as a table into notebooks.
+package vector
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/btwiuse/buildahfy/bases"
+	"github.com/btwiuse/buildahfy/features"
+	"github.com/btwiuse/buildahfy/stats"
+	"github.com/btwiuse/buildahfy/step"
+	"github.com/btwiuse/buildahfy/translate"
+	"github.com/btwiuse/buildahfy/validate"
+	"github.com/moby/buildkit/frontend/dockerfile/command"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/pkg/errors"
+)
+
+// instructions are counted in n_<name> columns; ONBUILD triggers are not.
+var instructions = []string{
+	"FROM", "RUN", "CMD", "ENTRYPOINT", "SHELL", "COPY", "ADD", "ENV", "ARG",
+	"LABEL", "MAINTAINER", "EXPOSE", "VOLUME", "WORKDIR", "USER",
+	"HEALTHCHECK", "STOPSIGNAL", "ONBUILD",
+}
+
+// flags are counted in flag_<instruction>_<flag> columns, with RUN
+// --mount split by type.
+var flags = []string{
+	"FROM --platform",
+	"RUN --mount=type=bind",
+	"RUN --mount=type=cache",
+	"RUN --mount=type=tmpfs",
+	"RUN --mount=type=secret",
+	"RUN --mount=type=ssh",
+	"RUN --network",
+	"RUN --security",
+	"COPY --from",
+	"COPY --chown",
+	"COPY --chmod",
+	"COPY --link",
+	"ADD --chown",
+	"ADD --chmod",
+	"ADD --link",
+}
+
+// Columns is the header of every table of rows.
+var Columns = []string{
+	"id", "lines",
+	"parse_buildkit", "parse_instructions", "parse_alt", "translate_status",
+	"stages", "base", "base_tag", "base_latest", "bases",
+}
+
+func init() {
+	for _, name := range instructions {
+		Columns = append(Columns, "n_"+strings.ToLower(name))
+	}
+	for _, flag := range flags {
+		Columns = append(Columns, column(flag))
+	}
+	Columns = append(Columns,
+		"run_exec", "run_chars_max", "run_chars_total", "run_commands_max", "run_commands_total", "run_lines_max",
+		"mounts", "heredoc", "onbuild", "meta_args", "arg_in_from", "syntax",
+		"min_docker", "min_docker_buildkit", "min_buildkit", "min_buildah",
+	)
+}
+
+// column names the column of a flag, as in flag_run_mount_cache.
+func column(flag string) string {
+	name := strings.ToLower(strings.NewReplacer(" --", "_", "=type=", "_", "-", "_").Replace(flag))
+	return "flag_" + name
+}
+
+// separators split a shell command line into commands, roughly: quoting
+// is not taken into account.
+var separators = regexp.MustCompile(`&&|\|\||;|\|`)
+
+// Row is one Dockerfile, with a value for each of Columns. Booleans are
+// 1 or 0, parse results ok or error, and unknown values empty.
+type Row map[string]string
+
+// Values returns the values of the row in the order of Columns.
+func (row Row) Values() []string {
+	values := make([]string, len(Columns))
+	for i, c := range Columns {
+		values[i] = row[c]
+	}
+	return values
+}
+
+// Compute fills in the row of the Dockerfile dt. The file is parsed
+// once, and each column read from that parse.
+func Compute(id string, dt []byte) Row {
+	row := Row{"id": id}
+	row["parse_alt"] = status(validate.Alt(bytes.NewReader(dt)))
+	res, err := parser.Parse(bytes.NewReader(dt))
+	row["parse_buildkit"] = status(err)
+	uses(row, dt, res, err)
+	if err != nil {
+		row["parse_instructions"] = "error"
+		row["translate_status"] = string(translate.Failed)
+		return row
+	}
+
+	s := stats.FromResult(res)
+	row["lines"] = strconv.Itoa(s.Lines)
+	row["stages"] = strconv.Itoa(s.Stages)
+	for _, name := range instructions {
+		row["n_"+strings.ToLower(name)] = strconv.Itoa(s.Instructions[name])
+	}
+	mounts := 0
+	for _, flag := range flags {
+		row[column(flag)] = strconv.Itoa(s.Flags[flag])
+		if strings.HasPrefix(flag, "RUN --mount") {
+			mounts += s.Flags[flag]
+		}
+	}
+	row["mounts"] = boolean(mounts > 0)
+	row["onbuild"] = boolean(s.Onbuild)
+	row["meta_args"] = boolean(s.MetaArgs)
+	row["arg_in_from"] = boolean(s.ArgInFrom)
+	row["run_exec"] = strconv.Itoa(s.Forms["RUN exec"])
+	runs(row, res, s)
+
+	steps, err := step.FromAST(res.AST)
+	if err != nil {
+		row["parse_instructions"] = "error"
+		row["translate_status"] = string(translate.Failed)
+		return row
+	}
+	row["parse_instructions"] = status(stages(steps))
+	row["translate_status"] = string(translate.StatusOf(steps))
+
+	if refs := bases.FromSteps(steps, res.EscapeToken, nil); len(refs) > 0 {
+		distinct := map[string]bool{}
+		for _, ref := range refs {
+			if !ref.Stage && !ref.Scratch {
+				distinct[ref.Resolved] = true
+			}
+		}
+		row["bases"] = strconv.Itoa(len(distinct))
+		last := refs[len(refs)-1]
+		row["base"] = last.Resolved
+		if last.Name != "" {
+			row["base"] = last.Name
+		}
+		row["base_tag"] = last.Tag
+		row["base_latest"] = boolean(last.Latest())
+	}
+	return row
+}
+
+// uses fills in the columns on the features dt uses, which res and err
+// are the result of parsing.
+func uses(row Row, dt []byte, res *parser.Result, err error) {
+	f, err := features.Uses(dt, res, err)
+	if err != nil {
+		return
+	}
+	row["heredoc"], row["syntax"] = "0", "0"
+	for _, name := range f.Features {
+		switch name {
+		case "heredoc":
+			row["heredoc"] = "1"
+		case "syntax directive":
+			row["syntax"] = "1"
+		}
+	}
+	row["min_docker"] = f.Docker
+	row["min_docker_buildkit"] = boolean(f.DockerBuildKit)
+	row["min_buildkit"] = f.BuildKit
+	row["min_buildah"] = f.Buildah
+}
+
+// stages fails as instructions.Parse does when steps do not form build
+// stages, that is when an instruction other than ARG precedes the first
+// FROM.
+func stages(steps []step.Step) error {
+	meta, _ := step.Stages(steps)
+	for _, s := range meta {
+		if s.Node.Value != command.Arg {
+			return errors.Errorf("line %d: no build stage in current context", s.Node.StartLine)
+		}
+	}
+	return nil
+}
+
+// runs fills in the columns on the complexity of RUN instructions.
+func runs(row Row, res *parser.Result, s *stats.Summary) {
+	maxChars, total := 0, 0
+	for _, n := range s.RunLengths {
+		total += n
+		if n > maxChars {
+			maxChars = n
+		}
+	}
+	row["run_chars_max"] = strconv.Itoa(maxChars)
+	row["run_chars_total"] = strconv.Itoa(total)
+
+	maxCommands, commands, maxLines := 0, 0, 0
+	for _, n := range res.AST.Children {
+		if n.Value != "run" {
+			continue
+		}
+		c := 1
+		if !n.Attributes["json"] && n.Next != nil {
+			c += len(separators.FindAllString(n.Next.Value, -1))
+		}
+		commands += c
+		if c > maxCommands {
+			maxCommands = c
+		}
+		if lines := n.EndLine - n.StartLine + 1; lines > maxLines {
+			maxLines = lines
+		}
+	}
+	row["run_commands_max"] = strconv.Itoa(maxCommands)
+	row["run_commands_total"] = strconv.Itoa(commands)
+	row["run_lines_max"] = strconv.Itoa(maxLines)
+}
+
+func status(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+func boolean(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,96 @@
+package vector
+
+import (
+	"testing"
+)
+
+func TestCompute(t *testing.T) {
+	dt := []byte("FROM golang:1.12 AS build\nRUN --mount=type=cache,target=/root/.cache go build && echo ok\nFROM alpine\nCOPY --from=build /app /app\n")
+	row := Compute("a", dt)
+	// instructions.Parse takes --mount only with the dfrunmount tag
+	for c, want := range map[string]string{
+		"id":                   "a",
+		"lines":                "4",
+		"parse_buildkit":       "ok",
+		"parse_instructions":   "error",
+		"stages":               "2",
+		"n_from":               "2",
+		"n_run":                "1",
+		"flag_run_mount_cache": "1",
+		"flag_copy_from":       "1",
+		"mounts":               "1",
+		"run_commands_max":     "2",
+		"run_chars_max":        "19",
+		"min_docker_buildkit":  "1",
+	} {
+		if row[c] != want {
+			t.Errorf("%s is %q, want %q", c, row[c], want)
+		}
+	}
+	for c := range row {
+		if !contains(Columns, c) {
+			t.Errorf("column %s is not in Columns", c)
+		}
+	}
+}
+
+func TestComputeBase(t *testing.T) {
+	for _, tc := range []struct {
+		dt    string
+		base  string
+		bases string
+	}{
+		{"FROM golang:1.12 AS build\nFROM build\nFROM alpine\n", "docker.io/library/alpine", "2"},
+		{"FROM golang:1.12 AS build\nFROM scratch\nCOPY --from=build /app /\n", "scratch", "1"},
+		{"FROM scratch\n", "scratch", "0"},
+	} {
+		row := Compute("a", []byte(tc.dt))
+		if row["base"] != tc.base || row["bases"] != tc.bases {
+			t.Errorf("%q: base %q of %s, want %q of %s", tc.dt, row["base"], row["bases"], tc.base, tc.bases)
+		}
+	}
+}
+
+func TestComputeStatuses(t *testing.T) {
+	for dt, want := range map[string][2]string{
+		"FROM alpine\nRUN true\n":                {"ok", "translated"},
+		"FROM alpine\nEXPOSE 80\nSTOPSIGNAL 9\n": {"ok", "translated"},
+		"FROM alpine\nARG version\n":             {"ok", "placeholder"},
+		"RUN true\nFROM alpine\n":                {"error", "translated"},
+		"FROM alpine\nFOO bar\n":                 {"error", "failed"},
+	} {
+		row := Compute("a", []byte(dt))
+		if got := [2]string{row["parse_instructions"], row["translate_status"]}; got != want {
+			t.Errorf("%q: parse_instructions and translate_status %q, want %q", dt, got, want)
+		}
+	}
+}
+
+func TestComputeUnparsable(t *testing.T) {
+	row := Compute("a", []byte("# escape=x\nFROM alpine\n"))
+	if row["parse_buildkit"] != "error" || row["lines"] != "" {
+		t.Errorf("row %v, want the parse error and no counts", row)
+	}
+}
+
+func TestValues(t *testing.T) {
+	row := Row{"id": "a", "stages": "1"}
+	values := row.Values()
+	if len(values) != len(Columns) {
+		t.Fatalf("%d values for %d columns", len(values), len(Columns))
+	}
+	for i, c := range Columns {
+		if values[i] != row[c] {
+			t.Errorf("value %d is %q, want %s %q", i, values[i], c, row[c])
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"log"
+	"os"
+	"runtime"
+
+	"github.com/btwiuse/buildahfy/corpus"
+	"github.com/btwiuse/buildahfy/translate"
+	"github.com/btwiuse/buildahfy/vector"
+)
+
+// vectorsMain writes one CSV row of features per record of the corpus.
+func vectorsMain(args []string) {
+	jobs := 0
+	fs := flag.NewFlagSet("vectors", flag.ExitOnError)
+	fs.IntVar(&jobs, "j", runtime.NumCPU(), "number of records to process in parallel")
+	path := addStoreFlag(fs)
+	in := addInputFlags(fs)
+	fs.Parse(args)
+
+	w := csv.NewWriter(os.Stdout)
+	if err := w.Write(vector.Columns); err != nil {
+		log.Fatal(err)
+	}
+	st := openStore(*path)
+	defer st.Close()
+	// a row holds the results of the analyses below, so it is stale
+	// whenever any of them is
+	vectorsBucket := bucket("vectors",
+		"translate="+translate.Version,
+		"features="+resultVersions["features"],
+		"bases="+resultVersions["bases"],
+		"stats="+resultVersions["stats"],
+	)
+	compute := func(rec *corpus.Record) interface{} {
+		row := vector.Row{}
+		loadStored(st, vectorsBucket, rec, &row, func() error {
+			row = vector.Compute(rec.Id, []byte(rec.Contents))
+			return nil
+		})
+		row["id"] = rec.Id
+		return row
+	}
+	emit := func(rec *corpus.Record, res interface{}) error {
+		return w.Write(res.(vector.Row).Values())
+	}
+	if err := in.mapRecords(nil, jobs, compute, emit); err != nil {
+		mapFailed(err)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Fatal(err)
+	}
+}